@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+type AtomFeed struct {
+	Title    AtomText     `xml:"title"`
+	Authors  []AtomPerson `xml:"author"`
+	Subtitle AtomText     `xml:"subtitle"`
+	Links    []AtomLink   `xml:"link"`
+	Entries  []AtomEntry  `xml:"entry"`
+}
+
+type AtomEntry struct {
+	ID         string         `xml:"id"`
+	Title      AtomText       `xml:"title"`
+	Links      []AtomLink     `xml:"link"`
+	Summary    AtomText       `xml:"summary"`
+	Content    AtomText       `xml:"content"`
+	Authors    []AtomPerson   `xml:"author"`
+	Categories []AtomCategory `xml:"category"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+}
+
+type AtomPerson struct {
+	Name  string `xml:"name"`
+	Email string `xml:"email"`
+}
+
+type AtomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+type AtomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr"`
+	Type   string `xml:"type,attr"`
+	Length int64  `xml:"length,attr"`
+}
+
+// AtomText is an Atom text construct. XHTML content is kept as raw markup
+// without its wrapping div, text and html content are taken from the
+// character data.
+type AtomText struct {
+	Type     string `xml:"type,attr"`
+	CharData string `xml:",chardata"`
+	InnerXML string `xml:",innerxml"`
+}
+
+func (t AtomText) String() string {
+	if t.Type == "xhtml" {
+		return unwrapXHTMLDiv(strings.TrimSpace(t.InnerXML))
+	}
+	return strings.TrimSpace(t.CharData)
+}
+
+// unwrapXHTMLDiv returns the content of the div that wraps XHTML text, which
+// RFC 4287 says is not part of the content itself. Markup that isn't a single
+// div is returned unchanged.
+func unwrapXHTMLDiv(markup string) string {
+	decoder := newLenientXMLDecoder([]byte(markup))
+	tok, err := decoder.Token()
+	if start, ok := tok.(xml.StartElement); err != nil || !ok || start.Name.Local != "div" {
+		return markup
+	}
+	contentStart := decoder.InputOffset()
+	for depth := 1; depth > 0; {
+		contentEnd := decoder.InputOffset()
+		tok, err := decoder.Token()
+		if err != nil {
+			return markup
+		}
+		switch tok.(type) {
+		case xml.StartElement:
+			depth++
+		case xml.EndElement:
+			depth--
+			if depth == 0 && decoder.InputOffset() == int64(len(markup)) {
+				return strings.TrimSpace(markup[contentStart:contentEnd])
+			}
+		}
+	}
+	return markup
+}
+
+// alternateLink returns the href of the rel="alternate" link, which is also
+// the default when rel is omitted, falling back to the first link.
+func alternateLink(links []AtomLink) string {
+	for _, link := range links {
+		if link.Rel == "" || link.Rel == "alternate" {
+			return link.Href
+		}
+	}
+	if len(links) > 0 {
+		return links[0].Href
+	}
+	return ""
+}
+
+// relLink returns the href of the first link with the given rel.
+func relLink(links []AtomLink, rel string) string {
+	for _, link := range links {
+		if link.Rel == rel {
+			return link.Href
+		}
+	}
+	return ""
+}
+
+// personNames joins the names of Atom persons, falling back to their email
+// when a name is missing.
+func personNames(persons []AtomPerson) string {
+	var names []string
+	for _, person := range persons {
+		name := strings.TrimSpace(person.Name)
+		if name == "" {
+			name = strings.TrimSpace(person.Email)
+		}
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+func parseAtom(decoder *xml.Decoder) (*ParsedFeed, error) {
+	var feed AtomFeed
+	if err := decoder.Decode(&feed); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal Atom XML: %w", err)
+	}
+
+	parsed := &ParsedFeed{
+		Title:       feed.Title.String(),
+		Link:        alternateLink(feed.Links),
+		Description: feed.Subtitle.String(),
+		Items:       make([]FeedItem, 0, len(feed.Entries)),
+	}
+	for _, entry := range feed.Entries {
+		description := entry.Summary.String()
+		content := entry.Content.String()
+		if description == "" {
+			description = content
+		}
+		pubDate := entry.Published
+		if pubDate == "" {
+			pubDate = entry.Updated
+		}
+		// Entries without an author inherit the feed's.
+		authors := entry.Authors
+		if len(authors) == 0 {
+			authors = feed.Authors
+		}
+		var categories []string
+		for _, category := range entry.Categories {
+			categories = append(categories, category.Term)
+		}
+		var enclosures []FeedEnclosure
+		for _, link := range entry.Links {
+			if link.Rel == "enclosure" {
+				enclosures = append(enclosures, FeedEnclosure{
+					URL:    link.Href,
+					Type:   link.Type,
+					Length: max(link.Length, 0),
+					Kind:   enclosureKind(link.Type, ""),
+				})
+			}
+		}
+		parsed.Items = append(parsed.Items, FeedItem{
+			GUID:        entry.ID,
+			Title:       entry.Title.String(),
+			Link:        alternateLink(entry.Links),
+			Description: description,
+			Content:     content,
+			Author:      personNames(authors),
+			PubDate:     strings.TrimSpace(pubDate),
+			Categories:  categories,
+			CommentsURL: relLink(entry.Links, "replies"),
+			Enclosures:  enclosures,
+		})
+	}
+	return parsed, nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+func TestAtomTextString(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"text", `<title type="text"> Fish &amp; Chips </title>`, "Fish & Chips"},
+		{"html", `<title type="html">&lt;b&gt;Bold&lt;/b&gt;</title>`, "<b>Bold</b>"},
+		{"no type", `<title>Plain</title>`, "Plain"},
+		{"xhtml", `<title type="xhtml"><div xmlns="http://www.w3.org/1999/xhtml"><b>Bold</b> title</div></title>`, "<b>Bold</b> title"},
+		{"xhtml whitespace", "<title type=\"xhtml\">\n  <div xmlns=\"http://www.w3.org/1999/xhtml\">\n    <p>One</p>\n    <p>Two</p>\n  </div>\n</title>", "<p>One</p>\n    <p>Two</p>"},
+		{"xhtml prefixed div", `<title type="xhtml"><xhtml:div xmlns:xhtml="http://www.w3.org/1999/xhtml">Hi</xhtml:div></title>`, "Hi"},
+		{"xhtml nested div", `<title type="xhtml"><div xmlns="http://www.w3.org/1999/xhtml"><div>Inner</div></div></title>`, "<div>Inner</div>"},
+		{"xhtml empty div", `<title type="xhtml"><div xmlns="http://www.w3.org/1999/xhtml"/></title>`, ""},
+		{"xhtml sibling divs", `<title type="xhtml"><div>One</div><div>Two</div></title>`, "<div>One</div><div>Two</div>"},
+		{"xhtml entity", `<title type="xhtml"><div xmlns="http://www.w3.org/1999/xhtml">A&amp;B</div></title>`, "A&amp;B"},
+		{"xhtml without div", `<title type="xhtml"><p>Bare</p></title>`, "<p>Bare</p>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var text AtomText
+			if err := xml.Unmarshal([]byte(tt.input), &text); err != nil {
+				t.Fatalf("xml.Unmarshal(%q) returned error: %v", tt.input, err)
+			}
+			if got := text.String(); got != tt.want {
+				t.Errorf("AtomText.String() of %q = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
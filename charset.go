@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"mime"
+	"regexp"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// xmlEncodingPattern matches the encoding of an XML declaration.
+var xmlEncodingPattern = regexp.MustCompile(`^\s*<\?xml[^>]*?\sencoding\s*=\s*["']([A-Za-z0-9._:-]+)["']`)
+
+// toUTF8 transcodes a feed document to UTF-8. The encoding is taken from a
+// byte order mark, the charset of the Content-Type header or the XML
+// declaration, in that order. Unknown encodings are read as UTF-8, and bytes
+// that can't be decoded are replaced rather than failing the whole feed.
+func toUTF8(body []byte, contentType string) []byte {
+	enc := documentEncoding(body, contentType)
+	if enc != nil && enc != unicode.UTF8 {
+		decoded, err := enc.NewDecoder().Bytes(body)
+		if err == nil {
+			body = decoded
+		}
+	}
+	body = bytes.TrimPrefix(body, []byte("\ufeff"))
+	if !utf8.Valid(body) {
+		body = bytes.ToValidUTF8(body, []byte("\ufffd"))
+	}
+	return body
+}
+
+// documentEncoding returns the encoding a document declares, or nil when it
+// declares none or one that isn't known.
+func documentEncoding(body []byte, contentType string) encoding.Encoding {
+	switch {
+	case bytes.HasPrefix(body, []byte{0xef, 0xbb, 0xbf}):
+		return unicode.UTF8
+	case bytes.HasPrefix(body, []byte{0xfe, 0xff}):
+		return unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM)
+	case bytes.HasPrefix(body, []byte{0xff, 0xfe}):
+		return unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM)
+	}
+
+	if _, params, err := mime.ParseMediaType(contentType); err == nil && params["charset"] != "" {
+		if enc, err := htmlindex.Get(params["charset"]); err == nil {
+			return enc
+		}
+	}
+	if match := xmlEncodingPattern.FindSubmatch(body); match != nil {
+		if enc, err := htmlindex.Get(string(match[1])); err == nil {
+			return enc
+		}
+	}
+	return nil
+}
+
+// newXMLDecoder returns a decoder for a document that toUTF8 has already
+// transcoded, so the encoding of its XML declaration no longer applies.
+func newXMLDecoder(body []byte) *xml.Decoder {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	return decoder
+}
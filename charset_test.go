@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestToUTF8(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		want        string
+	}{
+		{"UTF-8", "<title>Café</title>", "", "<title>Café</title>"},
+		{"UTF-8 BOM", "\xef\xbb\xbf<title>Café</title>", "", "<title>Café</title>"},
+		{"ISO-8859-1 declaration", "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><title>Caf\xe9</title>", "", "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><title>Café</title>"},
+		{"windows-1252 header", "<title>\x93quoted\x94 \x80</title>", "text/xml; charset=windows-1252", "<title>“quoted” €</title>"},
+		{"header beats declaration", "<?xml version=\"1.0\" encoding=\"UTF-8\"?><title>Caf\xe9</title>", "text/xml; charset=ISO-8859-1", "<?xml version=\"1.0\" encoding=\"UTF-8\"?><title>Café</title>"},
+		{"Shift_JIS", "<?xml version=\"1.0\" encoding=\"Shift_JIS\"?><title>\x93\xfa\x96\x7b</title>", "", "<?xml version=\"1.0\" encoding=\"Shift_JIS\"?><title>日本</title>"},
+		{"UTF-16 BOM", "\xff\xfe<\x00t\x00>\x00", "", "<t>"},
+		{"unknown encoding", "<?xml version=\"1.0\" encoding=\"bogus\"?><title>Café</title>", "", "<?xml version=\"1.0\" encoding=\"bogus\"?><title>Café</title>"},
+		{"invalid UTF-8", "<title>Caf\xe9</title>", "", "<title>Caf\ufffd</title>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(toUTF8([]byte(tt.body), tt.contentType))
+			if got != tt.want {
+				t.Errorf("toUTF8(%q, %q) = %q, want %q", tt.body, tt.contentType, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// dateLayouts are tried in order by parsePubDate, after normalizeDate has
+// stripped the day name and resolved named zones. They cover RSS (RFC 822 and
+// its many real-world variants), Atom and JSON Feed (RFC 3339) and the bare
+// ISO 8601 forms some generators emit.
+var dateLayouts = []string{
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04 -0700",
+	"2 Jan 2006 15:04 MST",
+	"2 Jan 06 15:04:05 -0700",
+	"2 Jan 06 15:04:05 MST",
+	"2 Jan 06 15:04 -0700",
+	"2 Jan 06 15:04 MST",
+	"2 January 2006 15:04:05 -0700",
+	"2 January 2006 15:04 -0700",
+	"2 Jan 2006 15:04:05",
+	"2 Jan 2006",
+	"02-Jan-06 15:04:05 -0700",
+	"02-Jan-2006 15:04:05 -0700",
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02T15:04:05-07",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	time.UnixDate,
+	time.RubyDate,
+	time.ANSIC,
+}
+
+// zoneOffsets maps the named time zones commonly found in feeds to their
+// numeric offsets. time.Parse reads any abbreviation it does not know from the
+// local zone database as UTC, so parsePubDate rejects the others.
+var zoneOffsets = map[string]string{
+	"UT":   "+0000",
+	"UTC":  "+0000",
+	"GMT":  "+0000",
+	"Z":    "+0000",
+	"EST":  "-0500",
+	"EDT":  "-0400",
+	"CST":  "-0600",
+	"CDT":  "-0500",
+	"MST":  "-0700",
+	"MDT":  "-0600",
+	"PST":  "-0800",
+	"PDT":  "-0700",
+	"AKST": "-0900",
+	"AKDT": "-0800",
+	"HST":  "-1000",
+	"BST":  "+0100",
+	"IST":  "+0530",
+	"WET":  "+0000",
+	"WEST": "+0100",
+	"CET":  "+0100",
+	"CEST": "+0200",
+	"EET":  "+0200",
+	"EEST": "+0300",
+	"MSK":  "+0300",
+	"JST":  "+0900",
+	"KST":  "+0900",
+	"AEST": "+1000",
+	"AEDT": "+1100",
+	"NZST": "+1200",
+	"NZDT": "+1300",
+}
+
+var (
+	leadingWeekdayPattern  = regexp.MustCompile(`^[A-Za-z]+,\s*`)
+	trailingZonePattern    = regexp.MustCompile(`\s([A-Za-z]{1,5})$`)
+	trailingCommentPattern = regexp.MustCompile(`\s*\([^)]*\)$`)
+)
+
+// parsePubDate parses the publication date of a feed item, trying every
+// layout in dateLayouts. The result is normalized to UTC; dates without a
+// zone are assumed to already be in UTC. Dates in a named zone that is neither
+// in zoneOffsets nor known locally are rejected rather than read as UTC.
+func parsePubDate(value string) (time.Time, error) {
+	normalized := normalizeDate(value)
+	if normalized == "" {
+		return time.Time{}, fmt.Errorf("empty date")
+	}
+
+	for _, layout := range dateLayouts {
+		t, err := time.Parse(layout, normalized)
+		if err != nil {
+			continue
+		}
+		// time.Parse records an unknown abbreviation in a made-up zone with
+		// a zero offset.
+		name, offset := t.Zone()
+		if offset == 0 && name != "" && t.Location() != time.UTC && t.Location() != time.Local {
+			return time.Time{}, fmt.Errorf("unknown time zone %q in date %q", name, value)
+		}
+		return t.UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date format: %q", value)
+}
+
+// normalizeDate collapses whitespace, drops the leading day name (which
+// feeds frequently get wrong or misspell) and trailing comments such as
+// "(UTC)", and replaces known zone names with numeric offsets.
+func normalizeDate(value string) string {
+	value = strings.Join(strings.Fields(value), " ")
+	value = leadingWeekdayPattern.ReplaceAllString(value, "")
+	value = trailingCommentPattern.ReplaceAllString(value, "")
+
+	if match := trailingZonePattern.FindStringSubmatch(value); match != nil {
+		if offset, ok := zoneOffsets[strings.ToUpper(match[1])]; ok {
+			value = strings.TrimSuffix(value, match[1]) + offset
+		}
+	}
+	return value
+}
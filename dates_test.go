@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePubDate(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  time.Time
+	}{
+		{"RFC1123Z", "Mon, 02 Jan 2006 15:04:05 -0700", time.Date(2006, 1, 2, 22, 4, 5, 0, time.UTC)},
+		{"RFC1123 GMT", "Tue, 10 Jun 2003 04:00:00 GMT", time.Date(2003, 6, 10, 4, 0, 0, 0, time.UTC)},
+		{"RFC1123 EST", "Fri, 15 Mar 2024 09:30:00 EST", time.Date(2024, 3, 15, 14, 30, 0, 0, time.UTC)},
+		{"RFC1123 PDT", "Wed, 05 Jul 2023 18:00:00 PDT", time.Date(2023, 7, 6, 1, 0, 0, 0, time.UTC)},
+		{"lowercase zone", "Wed, 05 Jul 2023 18:00:00 cest", time.Date(2023, 7, 5, 16, 0, 0, 0, time.UTC)},
+		{"single digit day", "Sat, 3 Feb 2024 08:15:00 +0100", time.Date(2024, 2, 3, 7, 15, 0, 0, time.UTC)},
+		{"no seconds", "Sat, 03 Feb 2024 08:15 +0000", time.Date(2024, 2, 3, 8, 15, 0, 0, time.UTC)},
+		{"two digit year", "Thu, 01 Jan 98 12:00:00 +0000", time.Date(1998, 1, 1, 12, 0, 0, 0, time.UTC)},
+		{"RFC822 two digit year", "01 Jan 21 12:00 EST", time.Date(2021, 1, 1, 17, 0, 0, 0, time.UTC)},
+		{"no weekday", "02 Jan 2006 15:04:05 +0000", time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)},
+		{"long weekday", "Tuesday, 10 Jun 2003 04:00:00 GMT", time.Date(2003, 6, 10, 4, 0, 0, 0, time.UTC)},
+		{"misspelled weekday", "Tues, 10 Jun 2003 04:00:00 GMT", time.Date(2003, 6, 10, 4, 0, 0, 0, time.UTC)},
+		{"long month", "Mon, 2 January 2006 15:04:05 +0000", time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)},
+		{"trailing comment", "Tue, 10 Jun 2003 04:00:00 +0000 (UTC)", time.Date(2003, 6, 10, 4, 0, 0, 0, time.UTC)},
+		{"extra whitespace", "  Tue,  10 Jun 2003\t04:00:00 GMT \n", time.Date(2003, 6, 10, 4, 0, 0, 0, time.UTC)},
+		{"RFC850", "Monday, 02-Jan-06 15:04:05 GMT", time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)},
+		{"RFC3339", "2024-05-06T07:08:09Z", time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)},
+		{"RFC3339 offset", "2024-05-06T07:08:09+02:00", time.Date(2024, 5, 6, 5, 8, 9, 0, time.UTC)},
+		{"RFC3339 fractional", "2024-05-06T07:08:09.123456Z", time.Date(2024, 5, 6, 7, 8, 9, 123456000, time.UTC)},
+		{"ISO compact offset", "2024-05-06T07:08:09-0500", time.Date(2024, 5, 6, 12, 8, 9, 0, time.UTC)},
+		{"ISO no zone", "2024-05-06T07:08:09", time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)},
+		{"ISO no seconds", "2024-05-06T07:08", time.Date(2024, 5, 6, 7, 8, 0, 0, time.UTC)},
+		{"ISO space separated", "2024-05-06 07:08:09", time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)},
+		{"ISO date only", "2024-05-06", time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC)},
+		{"UnixDate", "Mon Jan  2 15:04:05 UTC 2006", time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)},
+		{"RubyDate", "Mon Jan 02 15:04:05 -0700 2006", time.Date(2006, 1, 2, 22, 4, 5, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePubDate(tt.input)
+			if err != nil {
+				t.Fatalf("parsePubDate(%q) returned error: %v", tt.input, err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parsePubDate(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+			if got.Location() != time.UTC {
+				t.Errorf("parsePubDate(%q) location = %v, want UTC", tt.input, got.Location())
+			}
+		})
+	}
+}
+
+func TestParsePubDateInvalid(t *testing.T) {
+	for _, input := range []string{"", "   ", "yesterday", "32 Foo 2024 25:00:00 GMT", "2024-13-45",
+		"Sun, 06 Nov 1994 08:49:37 XYZ", "06 Nov 1994 08:49 QQT", "Sun Nov  6 08:49:37 XYZ 1994"} {
+		if got, err := parsePubDate(input); err == nil {
+			t.Errorf("parsePubDate(%q) = %v, want error", input, got)
+		}
+	}
+}
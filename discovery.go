@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// feedLinkTypes are the <link rel="alternate"> types that announce a feed.
+var feedLinkTypes = map[string]bool{
+	"application/rss+xml":   true,
+	"application/atom+xml":  true,
+	"application/rdf+xml":   true,
+	"application/feed+json": true,
+}
+
+// commonFeedPaths are probed on the site root when a page doesn't announce
+// its feeds.
+var commonFeedPaths = []string{
+	"/feed",
+	"/rss",
+	"/rss.xml",
+	"/atom.xml",
+	"/feed.xml",
+	"/index.xml",
+	"/feed.json",
+}
+
+// discoveryResult is the outcome of discoverFeed. FeedURL is the feed to
+// store and Feed its parsed content, Candidates every feed that was found,
+// FeedURL included.
+type discoveryResult struct {
+	FeedURL    string
+	Feed       *ParsedFeed
+	Candidates []string
+}
+
+// noFeedError is returned by discoverFeed when a page offers no feed that can
+// be fetched. It keeps the reason every candidate failed with.
+type noFeedError struct {
+	URL        string
+	Candidates []*candidateError
+}
+
+func (e *noFeedError) Error() string {
+	if len(e.Candidates) == 0 {
+		return fmt.Sprintf("no feed found at %s", e.URL)
+	}
+	reasons := make([]string, 0, len(e.Candidates))
+	for _, candidate := range e.Candidates {
+		reasons = append(reasons, candidate.Error())
+	}
+	return fmt.Sprintf("no feed found at %s: %s", e.URL, strings.Join(reasons, "; "))
+}
+
+func (e *noFeedError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Candidates))
+	for _, candidate := range e.Candidates {
+		errs = append(errs, candidate)
+	}
+	return errs
+}
+
+// candidateError is why a feed candidate of a page couldn't be fetched.
+type candidateError struct {
+	URL string
+	Err error
+}
+
+func (e *candidateError) Error() string {
+	return fmt.Sprintf("%s: %v", e.URL, e.Err)
+}
+
+func (e *candidateError) Unwrap() error {
+	return e.Err
+}
+
+// discoverFeed resolves a URL given by a user to a feed URL. Feed URLs are
+// returned unchanged. For HTML pages, the feeds announced with
+// <link rel="alternate"> tags are used, falling back to probing
+// commonFeedPaths; the first candidate that fetches as a feed is selected.
+func discoverFeed(ctx context.Context, client *feedClient, rawURL string) (*discoveryResult, error) {
+	resp, err := client.get(ctx, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &statusError{StatusCode: resp.StatusCode}
+	}
+
+	body, err := client.readBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	feed, parseErr := parseFeed(body, contentType)
+	if parseErr == nil {
+		return &discoveryResult{FeedURL: rawURL, Feed: feed, Candidates: []string{rawURL}}, nil
+	}
+	if !isHTML(body, contentType) {
+		return nil, parseErr
+	}
+
+	// Relative links resolve against the page we ended up on after redirects.
+	base := resp.Request.URL
+	candidates := findFeedLinks(body, base)
+	if len(candidates) == 0 {
+		// Probed paths have already been fetched successfully.
+		candidates, feed, failures := probeFeedPaths(ctx, client, base)
+		if len(candidates) == 0 {
+			return nil, &noFeedError{URL: rawURL, Candidates: failures}
+		}
+		return &discoveryResult{FeedURL: candidates[0], Feed: feed, Candidates: candidates}, nil
+	}
+
+	var failures []*candidateError
+	for _, candidate := range candidates {
+		result, err := fetchFeed(ctx, client, candidate, cacheValidators{})
+		if err == nil {
+			return &discoveryResult{FeedURL: candidate, Feed: result.Feed, Candidates: candidates}, nil
+		}
+		failures = append(failures, &candidateError{URL: candidate, Err: err})
+	}
+	return nil, &noFeedError{URL: rawURL, Candidates: failures}
+}
+
+// isHTML reports whether a response is an HTML page rather than a feed.
+func isHTML(body []byte, contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil && (mediaType == "text/html" || mediaType == "application/xhtml+xml") {
+		return true
+	}
+	prefix := bytes.ToLower(body[:min(len(body), 512)])
+	return bytes.Contains(prefix, []byte("<!doctype html")) || bytes.Contains(prefix, []byte("<html"))
+}
+
+// scriptPattern matches script and style elements, whose contents routinely
+// contain markup-like text that derails the XML tokenizer.
+var scriptPattern = regexp.MustCompile(`(?is)<(script|style)\b.*?</(script|style)\s*>`)
+
+// findFeedLinks returns the absolute URLs of the feeds an HTML page
+// announces in its head. The page is tokenized with a non-strict XML decoder,
+// which copes with most real-world HTML once scripts are removed; if it gives
+// up, the links found up to that point are returned.
+func findFeedLinks(body []byte, base *url.URL) []string {
+	body = scriptPattern.ReplaceAll(body, nil)
+	decoder := newLenientXMLDecoder(body)
+	decoder.AutoClose = xml.HTMLAutoClose
+
+	var links []string
+	seen := make(map[string]bool)
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			return links
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(start.Name.Local) {
+		case "body":
+			return links
+		case "link":
+		default:
+			continue
+		}
+
+		var rel, linkType, href string
+		for _, attr := range start.Attr {
+			switch strings.ToLower(attr.Name.Local) {
+			case "rel":
+				rel = strings.ToLower(attr.Value)
+			case "type":
+				linkType = strings.ToLower(strings.TrimSpace(attr.Value))
+			case "href":
+				href = strings.TrimSpace(attr.Value)
+			}
+		}
+		if href == "" || !feedLinkTypes[linkType] || !containsField(rel, "alternate") {
+			continue
+		}
+
+		ref, err := url.Parse(href)
+		if err != nil {
+			continue
+		}
+		link := base.ResolveReference(ref).String()
+		if !seen[link] {
+			seen[link] = true
+			links = append(links, link)
+		}
+	}
+}
+
+// probeFeedPaths returns the commonFeedPaths of a site that serve a feed,
+// along with the parsed content of the first one, and why the others failed.
+func probeFeedPaths(ctx context.Context, client *feedClient, base *url.URL) ([]string, *ParsedFeed, []*candidateError) {
+	var found []string
+	var first *ParsedFeed
+	var failures []*candidateError
+	for _, path := range commonFeedPaths {
+		candidate := base.ResolveReference(&url.URL{Path: path}).String()
+		result, err := fetchFeed(ctx, client, candidate, cacheValidators{})
+		if err != nil {
+			failures = append(failures, &candidateError{URL: candidate, Err: err})
+			continue
+		}
+		if first == nil {
+			first = result.Feed
+		}
+		found = append(found, candidate)
+	}
+	return found, first, failures
+}
+
+// containsField reports whether a space-separated attribute value such as
+// rel="alternate home" contains field.
+func containsField(value, field string) bool {
+	for _, f := range strings.Fields(value) {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchErrorReason explains why a URL could not be added as a feed, in
+// terms a user can act on.
+func fetchErrorReason(err error) string {
+	var dnsErr *net.DNSError
+	var statusErr *statusError
+	var syntaxErr *xml.SyntaxError
+	var jsonErr *json.SyntaxError
+	var noFeedErr *noFeedError
+	var readTimeoutErr *readTimeoutError
+	switch {
+	case errors.As(err, &noFeedErr):
+		if len(noFeedErr.Candidates) == 0 {
+			return "no feed found on the page"
+		}
+		reasons := make([]string, 0, len(noFeedErr.Candidates))
+		for _, candidate := range noFeedErr.Candidates {
+			reasons = append(reasons, fmt.Sprintf("%s (%s)", candidate.URL, fetchErrorReason(candidate.Err)))
+		}
+		return "no feed found on the page, tried " + strings.Join(reasons, ", ")
+	case errors.As(err, &dnsErr):
+		return fmt.Sprintf("DNS lookup failed for host %s", dnsErr.Name)
+	case errors.As(err, &statusErr):
+		return fmt.Sprintf("server responded with status %d %s", statusErr.StatusCode, http.StatusText(statusErr.StatusCode))
+	case errors.As(err, &syntaxErr):
+		return fmt.Sprintf("not a valid feed, XML error on line %d: %s", syntaxErr.Line, syntaxErr.Msg)
+	case errors.As(err, &jsonErr):
+		return fmt.Sprintf("not a valid feed, JSON error at offset %d: %v", jsonErr.Offset, jsonErr)
+	case errors.Is(err, context.DeadlineExceeded) || os.IsTimeout(err) || errors.As(err, &readTimeoutErr):
+		return "request timed out"
+	default:
+		return err.Error()
+	}
+}
@@ -1,96 +1,418 @@
 package main
 
 import (
+    "bytes"
     "context"
     "encoding/xml"
+    "errors"
     "fmt"
     "html"
-    "io"
     "net/http"
-    "log"
-    "github.com/KrishKoria/Gator/internal/database"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// ParsedFeed is the format-independent representation of a fetched feed.
+// Every supported feed format is normalized into it before scraping.
+type ParsedFeed struct {
+    Title       string
+    Link        string
+    Description string
+    // TTL is how long the publisher asks readers to cache the feed, from
+    // RSS <ttl> or the syndication module; zero when the feed gives no hint.
+    TTL time.Duration
+    // ParseWarning is the error strict XML parsing failed with when the feed
+    // could only be read in lenient mode.
+    ParseWarning string
+    Items        []FeedItem
+}
+
+// FeedItem is a single normalized entry of a ParsedFeed.
+type FeedItem struct {
+    GUID        string
+    Title       string
+    Link        string
+    Description string
+    Content     string
+    Author      string
+    PubDate     string
+    Categories  []string
+    CommentsURL string
+    Enclosures  []FeedEnclosure
+}
 
+// FeedEnclosure is a media file or image attached to a FeedItem. Kind is one
+// of enclosureMedia, enclosureImage or enclosureThumbnail. Duration and
+// Episode are only known for podcast media.
+type FeedEnclosure struct {
+    URL      string
+    Type     string
+    Length   int64
+    Kind     string
+    Duration time.Duration
+    Episode  int
+}
+
+type feedFormat int
+
+const (
+    formatUnknown feedFormat = iota
+    formatRSS
+    formatAtom
+    formatJSON
+    formatRDF
 )
 
 type RSSFeed struct {
     Channel struct {
-        Title       string    `xml:"title"`
-        Link        string    `xml:"link"`
-        Description string    `xml:"description"`
-        Item        []RSSItem `xml:"item"`
+        Title           string    `xml:"title"`
+        Link            string    `xml:"link"`
+        Description     string    `xml:"description"`
+        TTL             string    `xml:"ttl"`
+        UpdatePeriod    string    `xml:"http://purl.org/rss/1.0/modules/syndication/ updatePeriod"`
+        UpdateFrequency string    `xml:"http://purl.org/rss/1.0/modules/syndication/ updateFrequency"`
+        Item            []RSSItem `xml:"item"`
     } `xml:"channel"`
 }
 
 type RSSItem struct {
-    Title       string `xml:"title"`
-    Link        string `xml:"link"`
-    Description string `xml:"description"`
-    PubDate     string `xml:"pubDate"`
+    GUID           string           `xml:"guid"`
+    Title          string           `xml:"title"`
+    Link           string           `xml:"link"`
+    Description    string           `xml:"description"`
+    ContentEncoded string           `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+    Author         string           `xml:"author"`
+    Creator        string           `xml:"http://purl.org/dc/elements/1.1/ creator"`
+    PubDate        string           `xml:"pubDate"`
+    Category       []string         `xml:"category"`
+    Comments       string           `xml:"comments"`
+    Enclosure      []RSSEnclosure   `xml:"enclosure"`
+    MediaContent   []MediaContent   `xml:"http://search.yahoo.com/mrss/ content"`
+    MediaGroup     []MediaGroup     `xml:"http://search.yahoo.com/mrss/ group"`
+    MediaThumbnail []MediaThumbnail `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+    ITunesDuration string           `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+    ITunesEpisode  string           `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd episode"`
+    ITunesImage    ITunesImage      `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
 }
 
-func fetchFeed(ctx context.Context, feedURL string) (*RSSFeed, error) {
-    req, err := http.NewRequestWithContext(ctx, "GET", feedURL, nil)
-    if err != nil {
-        return nil, fmt.Errorf("failed to create request: %v", err)
+// cacheValidators are the HTTP validators a server sent with a feed, replayed
+// on the next fetch so unchanged feeds can be answered with 304 Not Modified.
+type cacheValidators struct {
+    ETag         string
+    LastModified string
+}
+
+// fetchResult is the outcome of fetchFeed. Feed is nil when NotModified is
+// set. MaxAge is the Cache-Control max-age the server sent, if any.
+type fetchResult struct {
+    Feed        *ParsedFeed
+    NotModified bool
+    Validators  cacheValidators
+    MaxAge      time.Duration
+}
+
+// statusError is returned by fetchFeed when the server answers with an
+// unexpected status code. RetryAfter holds the server's Retry-After hint for
+// 429 and 503 responses.
+type statusError struct {
+    StatusCode int
+    RetryAfter time.Duration
+}
+
+func (e *statusError) Error() string {
+    if e.RetryAfter > 0 {
+        return fmt.Sprintf("unexpected status code: %d (retry after %s)", e.StatusCode, e.RetryAfter)
     }
+    return fmt.Sprintf("unexpected status code: %d", e.StatusCode)
+}
 
-    req.Header.Set("User-Agent", "gator")
+func fetchFeed(ctx context.Context, client *feedClient, feedURL string, validators cacheValidators) (*fetchResult, error) {
+    header := make(http.Header)
+    if validators.ETag != "" {
+        header.Set("If-None-Match", validators.ETag)
+    }
+    if validators.LastModified != "" {
+        header.Set("If-Modified-Since", validators.LastModified)
+    }
 
-    client := &http.Client{}
-    resp, err := client.Do(req)
+    resp, err := client.get(ctx, feedURL, header)
     if err != nil {
-        return nil, fmt.Errorf("failed to fetch feed: %v", err)
+        return nil, fmt.Errorf("failed to fetch feed: %w", err)
     }
     defer resp.Body.Close()
 
+    maxAge := parseMaxAge(resp.Header.Get("Cache-Control"))
+    if resp.StatusCode == http.StatusNotModified {
+        return &fetchResult{NotModified: true, Validators: validators, MaxAge: maxAge}, nil
+    }
     if resp.StatusCode != http.StatusOK {
-        return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+        statusErr := &statusError{StatusCode: resp.StatusCode}
+        if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+            statusErr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+        }
+        return nil, statusErr
+    }
+
+    body, err := client.readBody(resp)
+    if err != nil {
+        return nil, err
+    }
+
+    feed, err := parseFeed(body, resp.Header.Get("Content-Type"))
+    if err != nil {
+        return nil, err
+    }
+
+    return &fetchResult{
+        Feed: feed,
+        Validators: cacheValidators{
+            ETag:         resp.Header.Get("ETag"),
+            LastModified: resp.Header.Get("Last-Modified"),
+        },
+        MaxAge: maxAge,
+    }, nil
+}
+
+// parseMaxAge extracts the max-age directive from a Cache-Control header.
+func parseMaxAge(cacheControl string) time.Duration {
+    for _, directive := range strings.Split(cacheControl, ",") {
+        name, value, found := strings.Cut(strings.TrimSpace(directive), "=")
+        if !found || !strings.EqualFold(name, "max-age") {
+            continue
+        }
+        seconds, err := strconv.Atoi(strings.Trim(value, `"`))
+        if err != nil || seconds < 0 {
+            return 0
+        }
+        return time.Duration(seconds) * time.Second
+    }
+    return 0
+}
+
+// parseRetryAfter interprets a Retry-After header, which is either a number
+// of seconds or an HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+    value = strings.TrimSpace(value)
+    if value == "" {
+        return 0
+    }
+    if seconds, err := strconv.Atoi(value); err == nil {
+        return max(time.Duration(seconds)*time.Second, 0)
+    }
+    if t, err := http.ParseTime(value); err == nil {
+        return max(t.Sub(now), 0)
+    }
+    return 0
+}
+
+// syndicationInterval turns the refresh hints of an RSS feed into a duration:
+// <ttl> is in minutes, the syndication module gives an update period that is
+// divided by its update frequency.
+func syndicationInterval(ttl, updatePeriod, updateFrequency string) time.Duration {
+    var interval time.Duration
+    if minutes, err := strconv.Atoi(strings.TrimSpace(ttl)); err == nil && minutes > 0 {
+        interval = time.Duration(minutes) * time.Minute
+    }
+
+    var period time.Duration
+    switch strings.ToLower(strings.TrimSpace(updatePeriod)) {
+    case "hourly":
+        period = time.Hour
+    case "daily":
+        period = 24 * time.Hour
+    case "weekly":
+        period = 7 * 24 * time.Hour
+    case "monthly":
+        period = 30 * 24 * time.Hour
+    case "yearly":
+        period = 365 * 24 * time.Hour
+    }
+    if period > 0 {
+        frequency, err := strconv.Atoi(strings.TrimSpace(updateFrequency))
+        if err != nil || frequency < 1 {
+            frequency = 1
+        }
+        interval = max(interval, period/time.Duration(frequency))
+    }
+    return interval
+}
+
+// parseFeed detects the format of a feed document and decodes it into a
+// ParsedFeed. contentType is the Content-Type header of the response, if any,
+// and is also consulted for the document's character encoding.
+func parseFeed(body []byte, contentType string) (*ParsedFeed, error) {
+    body = toUTF8(body, contentType)
+    format, err := detectFeedFormat(body, contentType)
+    if err != nil {
+        return nil, err
     }
 
-    body, err := io.ReadAll(resp.Body)
+    var feed *ParsedFeed
+    if format == formatJSON {
+        feed, err = parseJSONFeed(body)
+    } else {
+        feed, err = parseXMLFeed(format, body)
+    }
     if err != nil {
-        return nil, fmt.Errorf("failed to read response body: %v", err)
+        return nil, err
+    }
+
+    // Text in the XML formats often still contains escaped entities after
+    // decoding. The text fields of JSON Feed are plain text and are kept as
+    // they are.
+    unescape := html.UnescapeString
+    if format == formatJSON {
+        unescape = func(s string) string { return s }
+    }
+
+    feed.Title = unescape(feed.Title)
+    feed.Description = unescape(feed.Description)
+    for i := range feed.Items {
+        item := &feed.Items[i]
+        item.GUID = strings.TrimSpace(item.GUID)
+        item.Title = unescape(item.Title)
+        item.Description = unescape(item.Description)
+        item.Author = unescape(strings.TrimSpace(item.Author))
+        item.CommentsURL = strings.TrimSpace(item.CommentsURL)
+        item.Categories = cleanCategories(item.Categories, unescape)
+        item.Enclosures = cleanEnclosures(item.Enclosures)
+    }
+
+    return feed, nil
+}
+
+// cleanCategories unescapes and trims category names, dropping empty and
+// duplicate ones.
+func cleanCategories(categories []string, unescape func(string) string) []string {
+    var cleaned []string
+    seen := make(map[string]bool)
+    for _, category := range categories {
+        category = unescape(strings.TrimSpace(category))
+        if category == "" || seen[category] {
+            continue
+        }
+        seen[category] = true
+        cleaned = append(cleaned, category)
+    }
+    return cleaned
+}
+
+// detectFeedFormat decides which parser should handle a document. JSON Feeds
+// are recognized by their content type or version field, anything else is
+// treated as XML and classified by its root element.
+func detectFeedFormat(body []byte, contentType string) (feedFormat, error) {
+    if isJSONContentType(contentType) || isJSONFeed(body) {
+        return formatJSON, nil
+    }
+
+    decoder := newLenientXMLDecoder(stripInvalidXMLChars(body))
+    for {
+        tok, err := decoder.Token()
+        if err != nil {
+            return formatUnknown, fmt.Errorf("failed to read XML root element: %w", err)
+        }
+        start, ok := tok.(xml.StartElement)
+        if !ok {
+            continue
+        }
+        switch start.Name.Local {
+        case "rss":
+            return formatRSS, nil
+        case "feed":
+            return formatAtom, nil
+        case "RDF":
+            return formatRDF, nil
+        default:
+            return formatUnknown, fmt.Errorf("unsupported feed format: root element <%s>", start.Name.Local)
+        }
+    }
+}
+
+// parseXMLFeed decodes an XML feed document. Documents that strict parsing
+// rejects, typically because of undeclared HTML entities, stray ampersands or
+// control characters, are decoded again in lenient mode.
+func parseXMLFeed(format feedFormat, body []byte) (*ParsedFeed, error) {
+    feed, err := decodeXMLFeed(format, newXMLDecoder(body))
+    var syntaxErr *xml.SyntaxError
+    if !errors.As(err, &syntaxErr) {
+        return feed, err
+    }
+
+    feed, lenientErr := decodeXMLFeed(format, newLenientXMLDecoder(stripInvalidXMLChars(body)))
+    if lenientErr != nil {
+        return nil, err
     }
+    feed.ParseWarning = err.Error()
+    return feed, nil
+}
 
+// newLenientXMLDecoder returns a decoder that accepts malformed documents:
+// HTML named entities are resolved, and unknown entities and stray ampersands
+// are kept as text.
+func newLenientXMLDecoder(body []byte) *xml.Decoder {
+    decoder := newXMLDecoder(body)
+    decoder.Strict = false
+    decoder.Entity = xml.HTMLEntity
+    return decoder
+}
+
+// stripInvalidXMLChars removes the characters XML 1.0 doesn't allow, such
+// as control characters, which no decoder mode accepts.
+func stripInvalidXMLChars(body []byte) []byte {
+    return bytes.Map(func(r rune) rune {
+        switch {
+        case r == '\t' || r == '\n' || r == '\r':
+            return r
+        case r < 0x20, r == 0xfffe, r == 0xffff:
+            return -1
+        }
+        return r
+    }, body)
+}
+
+func decodeXMLFeed(format feedFormat, decoder *xml.Decoder) (*ParsedFeed, error) {
+    switch format {
+    case formatAtom:
+        return parseAtom(decoder)
+    case formatRDF:
+        return parseRDF(decoder)
+    default:
+        return parseRSS(decoder)
+    }
+}
+
+func parseRSS(decoder *xml.Decoder) (*ParsedFeed, error) {
     var feed RSSFeed
-    if err := xml.Unmarshal(body, &feed); err != nil {
-        return nil, fmt.Errorf("failed to unmarshal XML: %v", err)
-    }
-
-    feed.Channel.Title = html.UnescapeString(feed.Channel.Title)
-    feed.Channel.Description = html.UnescapeString(feed.Channel.Description)
-    for i := range feed.Channel.Item {
-        feed.Channel.Item[i].Title = html.UnescapeString(feed.Channel.Item[i].Title)
-        feed.Channel.Item[i].Description = html.UnescapeString(feed.Channel.Item[i].Description)
-    }
-
-    return &feed, nil
-}
-
-func scrapeFeeds(s *state) {
-	feed, err := s.DBQueries.GetNextFeedToFetch(context.Background())
-	if err != nil {
-		log.Println("Couldn't get next feeds to fetch", err)
-		return
-	}
-	log.Println("Found a feed to fetch!")
-	scrapeFeed(s.DBQueries, feed)
-}
-
-func scrapeFeed(db *database.Queries, feed database.Feed) {
-	_, err := db.MarkFeedFetched(context.Background(), feed.ID)
-	if err != nil {
-		log.Printf("Couldn't mark feed %s fetched: %v", feed.Name, err)
-		return
-	}
-
-	feedData, err := fetchFeed(context.Background(), feed.Url)
-	if err != nil {
-		log.Printf("Couldn't collect feed %s: %v", feed.Name, err)
-		return
-	}
-	for _, item := range feedData.Channel.Item {
-		fmt.Printf("Found post: %s\n", item.Title)
-	}
-	log.Printf("Feed %s collected, %v posts found", feed.Name, len(feedData.Channel.Item))
-}
\ No newline at end of file
+    if err := decoder.Decode(&feed); err != nil {
+        return nil, fmt.Errorf("failed to unmarshal XML: %w", err)
+    }
+
+    parsed := &ParsedFeed{
+        Title:       feed.Channel.Title,
+        Link:        feed.Channel.Link,
+        Description: feed.Channel.Description,
+        TTL:         syndicationInterval(feed.Channel.TTL, feed.Channel.UpdatePeriod, feed.Channel.UpdateFrequency),
+        Items:       make([]FeedItem, 0, len(feed.Channel.Item)),
+    }
+    for _, item := range feed.Channel.Item {
+        // dc:creator holds a name, while RSS <author> is an email address.
+        author := item.Creator
+        if author == "" {
+            author = item.Author
+        }
+        parsed.Items = append(parsed.Items, FeedItem{
+            GUID:        item.GUID,
+            Title:       item.Title,
+            Link:        item.Link,
+            Description: item.Description,
+            Content:     item.ContentEncoded,
+            Author:      author,
+            PubDate:     item.PubDate,
+            Categories:  item.Category,
+            CommentsURL: item.Comments,
+            Enclosures:  rssEnclosures(item),
+        })
+    }
+    return parsed, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSyndicationInterval(t *testing.T) {
+	tests := []struct {
+		name            string
+		ttl             string
+		updatePeriod    string
+		updateFrequency string
+		want            time.Duration
+	}{
+		{"no hints", "", "", "", 0},
+		{"ttl", "60", "", "", time.Hour},
+		{"ttl with whitespace", " 15 ", "", "", 15 * time.Minute},
+		{"invalid ttl", "soon", "", "", 0},
+		{"negative ttl", "-5", "", "", 0},
+		{"hourly", "", "hourly", "", time.Hour},
+		{"daily twice", "", "daily", "2", 12 * time.Hour},
+		{"weekly", "", "Weekly", "1", 7 * 24 * time.Hour},
+		{"invalid frequency", "", "daily", "0", 24 * time.Hour},
+		{"unknown period", "", "fortnightly", "1", 0},
+		{"longest hint wins", "120", "hourly", "1", 2 * time.Hour},
+		{"period beats ttl", "10", "daily", "1", 24 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := syndicationInterval(tt.ttl, tt.updatePeriod, tt.updateFrequency)
+			if got != tt.want {
+				t.Errorf("syndicationInterval(%q, %q, %q) = %v, want %v", tt.ttl, tt.updatePeriod, tt.updateFrequency, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectFeedFormat(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		want        feedFormat
+	}{
+		{"RSS", `<?xml version="1.0"?><rss version="2.0"><channel></channel></rss>`, "application/rss+xml", formatRSS},
+		{"RSS with comment", `<?xml version="1.0"?><!-- generated --><rss><channel></channel></rss>`, "", formatRSS},
+		{"Atom", `<feed xmlns="http://www.w3.org/2005/Atom"></feed>`, "application/atom+xml", formatAtom},
+		{"RDF", `<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"></rdf:RDF>`, "", formatRDF},
+		{"JSON Feed by content type", `{"version": "https://jsonfeed.org/version/1.1"}`, "application/feed+json", formatJSON},
+		{"JSON Feed sniffed", `{"version": "https://jsonfeed.org/version/1"}`, "text/plain", formatJSON},
+		{"RSS with HTML entity", `<rss><channel><title>A&nbsp;B</title></channel></rss>`, "text/xml", formatRSS},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := detectFeedFormat([]byte(tt.body), tt.contentType)
+			if err != nil {
+				t.Fatalf("detectFeedFormat(%q) returned error: %v", tt.body, err)
+			}
+			if got != tt.want {
+				t.Errorf("detectFeedFormat(%q) = %v, want %v", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectFeedFormatInvalid(t *testing.T) {
+	for _, body := range []string{"", "not a feed", `<html><body></body></html>`, `{"title": "no version"}`} {
+		if got, err := detectFeedFormat([]byte(body), ""); err == nil {
+			t.Errorf("detectFeedFormat(%q) = %v, want error", body, got)
+		}
+	}
+}
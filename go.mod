@@ -7,6 +7,8 @@ replace github.com/KrishKoria/GatorConfig v0.0.0 => ./internal/config/
 require github.com/KrishKoria/GatorConfig v0.0.0
 
 require (
+	github.com/andybalholm/brotli v1.2.0
 	github.com/google/uuid v1.6.0 
 	github.com/lib/pq v1.10.9 
+	golang.org/x/text v0.28.0
 )
@@ -2,13 +2,17 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"time"
 	"github.com/google/uuid"
 	_ "github.com/lib/pq"
     "strconv"
+    "strings"
     "log"
+    "math"
 	"github.com/KrishKoria/Gator/internal/database"
 )
 
@@ -45,7 +49,7 @@ func handlerRegister(s *state, cmd command) error {
     }
 
     userID := uuid.New()
-    now := time.Now()
+    now := time.Now().UTC()
     user, err := s.DBQueries.CreateUser(context.Background(), database.CreateUserParams{
         ID:        userID,
         CreatedAt: now,
@@ -61,8 +65,10 @@ func handlerRegister(s *state, cmd command) error {
         return fmt.Errorf("error setting user: %v", err)
     }
 
-    fmt.Printf("User created: %+v\n", user)
-    return nil
+    record := userRecord{ID: user.ID, Name: user.Name, CreatedAt: user.CreatedAt.UTC(), Current: true}
+    return s.renderOne(record, func() {
+        fmt.Printf("User created: %s (ID %s)\n", user.Name, user.ID)
+    })
 }
 
 func handlerUsers(s *state, cmd command) error {
@@ -72,14 +78,25 @@ func handlerUsers(s *state, cmd command) error {
     }
 
     currentUser := s.Config.CurrentUserName
+    records := make([]userRecord, 0, len(users))
     for _, user := range users {
-        if user.Name == currentUser {
-            fmt.Printf("* %s (current)\n", user.Name)
-        } else {
-            fmt.Printf("* %s\n", user.Name)
-        }
+        records = append(records, userRecord{
+            ID:        user.ID,
+            Name:      user.Name,
+            CreatedAt: user.CreatedAt.UTC(),
+            Current:   user.Name == currentUser,
+        })
     }
-    return nil
+
+    return s.render(records, func() {
+        for _, user := range records {
+            if user.Current {
+                fmt.Printf("* %s (current)\n", user.Name)
+            } else {
+                fmt.Printf("* %s\n", user.Name)
+            }
+        }
+    })
 }
 
 func handlerReset(s *state, cmd command) error {
@@ -107,7 +124,7 @@ func handlerReset(s *state, cmd command) error {
 
 func handlerAgg(s *state, cmd command) error {
 	if len(cmd.Args) < 1 || len(cmd.Args) > 2 {
-		return fmt.Errorf("usage: %v <time_between_reqs>", cmd.Name)
+		return fmt.Errorf("usage: %v <time_between_reqs> [concurrency]", cmd.Name)
 	}
 
 	timeBetweenRequests, err := time.ParseDuration(cmd.Args[0])
@@ -115,44 +132,88 @@ func handlerAgg(s *state, cmd command) error {
 		return fmt.Errorf("invalid duration: %w", err)
 	}
 
-	log.Printf("Collecting feeds every %s...", timeBetweenRequests)
+	concurrency := 1
+	if len(cmd.Args) == 2 {
+		concurrency, err = strconv.Atoi(cmd.Args[1])
+		if err != nil || concurrency < 1 {
+			return fmt.Errorf("invalid concurrency: %s", cmd.Args[1])
+		}
+	}
+
+	log.Printf("Collecting up to %d feeds every %s...", concurrency, timeBetweenRequests)
+
+	scraper := newFeedScraper(s.DBQueries, s.HTTPClient, concurrency, feedFetchTimeout)
+	scraper.start(context.Background())
 
 	ticker := time.NewTicker(timeBetweenRequests)
 
 	for ; ; <-ticker.C {
-		scrapeFeeds(s)
+		scraper.scrapeBatch(context.Background())
 	}
 }
 
 
 func handlerAddFeed(s *state, cmd command, user database.User) error {
-    if len(cmd.Args) < 2 {
-        return fmt.Errorf("enter a feed name and URL")
+    args, ingest := extractFlag(cmd.Args, "--ingest")
+    if len(args) < 1 || len(args) > 3 {
+        return fmt.Errorf("usage: %v <url> [--ingest] or %v <name> <url> [fetch_interval] [--ingest]", cmd.Name, cmd.Name)
+    }
+
+    // A single argument is the URL and the name is taken from the feed,
+    // otherwise the name comes first.
+    var feedName, feedURL string
+    fetchInterval := sql.NullInt32{}
+    if len(args) == 1 {
+        feedURL = args[0]
+    } else {
+        feedName = args[0]
+        feedURL = args[1]
+    }
+    if err := validateFeedURL(feedURL); err != nil {
+        return err
+    }
+    if len(args) == 3 {
+        var err error
+        fetchInterval, err = parseFetchInterval(args[2])
+        if err != nil {
+            return err
+        }
+    }
+
+    discovered, err := discoverFeed(context.Background(), s.HTTPClient, feedURL)
+    if err != nil {
+        return fmt.Errorf("cannot add %s: %s", feedURL, fetchErrorReason(err))
+    }
+    printDiscovery(s, feedURL, discovered)
+    feedURL = discovered.FeedURL
+
+    if feedName == "" {
+        feedName = strings.TrimSpace(discovered.Feed.Title)
+    }
+    if feedName == "" {
+        feedName = feedURL
     }
-    feedName := cmd.Args[0]
-    feedURL := cmd.Args[1]
 
     currentUser := s.Config.CurrentUserName
-    user, err := s.DBQueries.GetUser(context.Background(), currentUser)
+    user, err = s.DBQueries.GetUser(context.Background(), currentUser)
     if err != nil {
         return fmt.Errorf("error getting current user: %v", err)
     }
 
     feedID := uuid.New()
-    now := time.Now()
+    now := time.Now().UTC()
     feed, err := s.DBQueries.CreateFeed(context.Background(), database.CreateFeedParams{
-        ID:        feedID,
-        CreatedAt: now,
-        UpdatedAt: now,
-        Name:      feedName,
-        Url:       feedURL,
-        UserID:    user.ID,
+        ID:                   feedID,
+        CreatedAt:            now,
+        UpdatedAt:            now,
+        Name:                 feedName,
+        Url:                  feedURL,
+        UserID:               user.ID,
+        FetchIntervalSeconds: fetchInterval,
     })
     if err != nil {
         return fmt.Errorf("error creating feed: %v", err)
     }
-    
-    fmt.Printf("Feed created: %+v\n", feed)
 
     followID := uuid.New()
     follow, err := s.DBQueries.CreateFeedFollow(context.Background(), database.CreateFeedFollowParams{
@@ -166,23 +227,330 @@ func handlerAddFeed(s *state, cmd command, user database.User) error {
         return fmt.Errorf("error following feed: %v", err)
     }
 
-    fmt.Printf("Now following '%s' as user '%s'\n", follow.FeedName, follow.UserName)
-    
+    err = s.renderOne(newFeedRecord(feed, user.Name), func() {
+        fmt.Printf("Feed created: '%s' (%s)\n", feed.Name, feed.Url)
+    })
+    if err != nil {
+        return err
+    }
+    s.notice("Now following '%s' as user '%s'\n", follow.FeedName, follow.UserName)
+
+    if ingest {
+        stats := savePosts(context.Background(), s.DBQueries, feed, discovered.Feed.Items)
+        s.notice("Ingested %d posts: %s\n", len(discovered.Feed.Items), stats)
+    }
+
+    return nil
+}
+
+func handlerEditFeed(s *state, cmd command, user database.User) error {
+    if len(cmd.Args) < 2 {
+        return fmt.Errorf("usage: %v <url> <fetch_interval|default>", cmd.Name)
+    }
+    feedURL := cmd.Args[0]
+
+    fetchInterval, err := parseFetchInterval(cmd.Args[1])
+    if err != nil {
+        return err
+    }
+
+    feed, err := s.DBQueries.GetFeedByURL(context.Background(), feedURL)
+    if err != nil {
+        return fmt.Errorf("feed not found with URL %s: %v", feedURL, err)
+    }
+    if feed.UserID != user.ID {
+        return fmt.Errorf("only the user who added feed %s can edit it", feedURL)
+    }
+
+    err = s.DBQueries.UpdateFeedFetchInterval(context.Background(), database.UpdateFeedFetchIntervalParams{
+        ID:                   feed.ID,
+        FetchIntervalSeconds: fetchInterval,
+    })
+    if err != nil {
+        return fmt.Errorf("error updating feed: %v", err)
+    }
+
+    if fetchInterval.Valid {
+        fmt.Printf("Feed '%s' will be fetched at most every %s\n", feed.Name, time.Duration(fetchInterval.Int32)*time.Second)
+    } else {
+        fmt.Printf("Feed '%s' will be fetched on the default schedule\n", feed.Name)
+    }
     return nil
 }
 
+// extractFlag removes a boolean flag from args, reporting whether it was
+// present.
+func extractFlag(args []string, flag string) ([]string, bool) {
+    rest := make([]string, 0, len(args))
+    found := false
+    for _, arg := range args {
+        if arg == flag {
+            found = true
+            continue
+        }
+        rest = append(rest, arg)
+    }
+    return rest, found
+}
+
+// extractFlagValue removes a flag and the value following it from args. The
+// value is empty when the flag is absent.
+func extractFlagValue(args []string, flag string) ([]string, string, error) {
+    rest := make([]string, 0, len(args))
+    value := ""
+    for i := 0; i < len(args); i++ {
+        if args[i] != flag {
+            rest = append(rest, args[i])
+            continue
+        }
+        if i+1 >= len(args) {
+            return nil, "", fmt.Errorf("%s needs a value", flag)
+        }
+        value = args[i+1]
+        i++
+    }
+    return rest, value, nil
+}
+
+// parseFetchInterval parses the minimum fetch interval argument of addfeed and
+// editfeed. "default" clears the interval.
+func parseFetchInterval(arg string) (sql.NullInt32, error) {
+    if arg == "default" {
+        return sql.NullInt32{}, nil
+    }
+    interval, err := time.ParseDuration(arg)
+    if err != nil || interval < time.Second {
+        return sql.NullInt32{}, fmt.Errorf("invalid fetch interval: %s", arg)
+    }
+    if interval > math.MaxInt32*time.Second {
+        return sql.NullInt32{}, fmt.Errorf("fetch interval %s is too long, the maximum is %s", arg, math.MaxInt32*time.Second)
+    }
+    return sql.NullInt32{Int32: int32(interval / time.Second), Valid: true}, nil
+}
+
+func handlerImport(s *state, cmd command, user database.User) error {
+    if len(cmd.Args) < 1 {
+        return fmt.Errorf("usage: %v <file.opml>", cmd.Name)
+    }
+
+    data, err := os.ReadFile(cmd.Args[0])
+    if err != nil {
+        return fmt.Errorf("error reading OPML file: %v", err)
+    }
+    doc, err := parseOPML(data)
+    if err != nil {
+        return err
+    }
+
+    subs, invalid := doc.subscriptions()
+
+    var created, followed, alreadyFollowed, duplicates int
+    seen := make(map[string]bool)
+    for _, sub := range subs {
+        if seen[sub.XMLURL] {
+            duplicates++
+            continue
+        }
+        seen[sub.XMLURL] = true
+
+        now := time.Now().UTC()
+        feed, err := s.DBQueries.GetFeedByURL(context.Background(), sub.XMLURL)
+        if errors.Is(err, sql.ErrNoRows) {
+            feed, err = s.DBQueries.CreateFeed(context.Background(), database.CreateFeedParams{
+                ID:        uuid.New(),
+                CreatedAt: now,
+                UpdatedAt: now,
+                Name:      sub.Name,
+                Url:       sub.XMLURL,
+                UserID:    user.ID,
+            })
+            if err == nil {
+                created++
+            }
+        }
+        if err != nil {
+            invalid = append(invalid, opmlInvalidEntry{Name: sub.Name, Reason: err.Error()})
+            continue
+        }
+        // The scraper keeps the site URL up to date once the feed is
+        // fetched; until then the one from the file is used.
+        if sub.HTMLURL != "" && !feed.SiteUrl.Valid {
+            err = s.DBQueries.UpdateFeedSiteURL(context.Background(), database.UpdateFeedSiteURLParams{
+                ID:      feed.ID,
+                SiteUrl: sql.NullString{String: sub.HTMLURL, Valid: true},
+            })
+            if err != nil {
+                log.Printf("Couldn't store site URL of feed %s: %v", feed.Name, err)
+            }
+        }
+
+        _, err = s.DBQueries.CreateFeedFollow(context.Background(), database.CreateFeedFollowParams{
+            ID:        uuid.New(),
+            CreatedAt: now,
+            UpdatedAt: now,
+            UserID:    user.ID,
+            FeedID:    feed.ID,
+            Folder:    sql.NullString{String: sub.Folder, Valid: sub.Folder != ""},
+        })
+        if isUniqueViolation(err) {
+            alreadyFollowed++
+            continue
+        }
+        if err != nil {
+            invalid = append(invalid, opmlInvalidEntry{Name: sub.Name, Reason: err.Error()})
+            continue
+        }
+        followed++
+    }
+
+    record := importRecord{
+        File:            cmd.Args[0],
+        FeedsCreated:    created,
+        FeedsFollowed:   followed,
+        AlreadyFollowed: alreadyFollowed,
+        Duplicates:      duplicates,
+        Invalid:         append([]opmlInvalidEntry{}, invalid...),
+    }
+    return s.renderOne(record, func() {
+        fmt.Printf("Imported %s as user '%s'\n", record.File, user.Name)
+        fmt.Printf("Feeds created: %d\n", record.FeedsCreated)
+        fmt.Printf("Feeds followed: %d\n", record.FeedsFollowed)
+        fmt.Printf("Already followed: %d\n", record.AlreadyFollowed)
+        fmt.Printf("Duplicates in file: %d\n", record.Duplicates)
+        fmt.Printf("Invalid entries: %d\n", len(record.Invalid))
+        for _, entry := range record.Invalid {
+            fmt.Printf("* %s: %s\n", entry.Name, entry.Reason)
+        }
+    })
+}
+
+func handlerExport(s *state, cmd command, user database.User) error {
+    feedFollows, err := s.DBQueries.GetFeedFollowsForUser(context.Background(), user.ID)
+    if err != nil {
+        return fmt.Errorf("error getting followed feeds: %v", err)
+    }
+
+    subs := make([]opmlSubscription, 0, len(feedFollows))
+    for _, follow := range feedFollows {
+        subs = append(subs, opmlSubscription{
+            Name:    follow.FeedName,
+            XMLURL:  follow.FeedUrl,
+            HTMLURL: follow.SiteUrl.String,
+            Folder:  follow.Folder.String,
+        })
+    }
+
+    doc := newOPML(fmt.Sprintf("Gator subscriptions of %s", user.Name), user.Name, time.Now(), subs)
+    data, err := doc.marshal()
+    if err != nil {
+        return err
+    }
+
+    if len(cmd.Args) == 0 {
+        _, err = os.Stdout.Write(data)
+        return err
+    }
+    if err := os.WriteFile(cmd.Args[0], data, 0644); err != nil {
+        return fmt.Errorf("error writing OPML file: %v", err)
+    }
+    fmt.Printf("Exported %d feeds to %s\n", len(subs), cmd.Args[0])
+    return nil
+}
+
+// printDiscovery tells the user which feed was found for the URL they gave,
+// and which other feeds the page offers.
+func printDiscovery(s *state, requestedURL string, discovered *discoveryResult) {
+    if discovered.FeedURL == requestedURL {
+        return
+    }
+    s.notice("Found feed %s for %s\n", discovered.FeedURL, requestedURL)
+    if len(discovered.Candidates) > 1 {
+        s.notice("Other feeds offered by this page:\n")
+        for _, candidate := range discovered.Candidates {
+            if candidate != discovered.FeedURL {
+                s.notice("* %s\n", candidate)
+            }
+        }
+    }
+}
+
 func handlerFeeds(s *state, cmd command) error {
     feeds, err := s.DBQueries.GetFeedsWithUsers(context.Background())
     if err != nil {
         return fmt.Errorf("error getting feeds: %v", err)
     }
 
+    records := make([]feedRecord, 0, len(feeds))
     for _, feed := range feeds {
-        fmt.Printf("Feed Name: %s\n", feed.FeedName)
-        fmt.Printf("Feed URL: %s\n", feed.Url)
-        fmt.Printf("Created by: %s\n\n", feed.UserName)
+        records = append(records, feedRecord{
+            ID:                   feed.ID,
+            Name:                 feed.FeedName,
+            URL:                  feed.Url,
+            SiteURL:              nullableString(feed.SiteUrl),
+            CreatedBy:            feed.UserName,
+            CreatedAt:            feed.CreatedAt.UTC(),
+            FetchIntervalSeconds: nullableInt32(feed.FetchIntervalSeconds),
+            LastFetchedAt:        nullableTime(feed.LastFetchedAt),
+        })
     }
-    return nil
+
+    return s.render(records, func() {
+        for _, feed := range records {
+            fmt.Printf("Feed Name: %s\n", feed.Name)
+            fmt.Printf("Feed URL: %s\n", feed.URL)
+            fmt.Printf("Created by: %s\n\n", feed.CreatedBy)
+        }
+    })
+}
+
+func handlerUnhealthy(s *state, cmd command) error {
+    feeds, err := s.DBQueries.GetUnhealthyFeeds(context.Background())
+    if err != nil {
+        return fmt.Errorf("error getting unhealthy feeds: %v", err)
+    }
+
+    records := make([]unhealthyFeedRecord, 0, len(feeds))
+    for _, feed := range feeds {
+        records = append(records, unhealthyFeedRecord{
+            ID:                  feed.ID,
+            Name:                feed.Name,
+            URL:                 feed.Url,
+            ConsecutiveFailures: feed.ConsecutiveFailures,
+            LastError:           nullableString(feed.LastError),
+            LastSuccessAt:       nullableTime(feed.LastSuccessAt),
+            NextFetchAt:         nullableTime(feed.NextFetchAt),
+            ParseWarning:        nullableString(feed.ParseWarning),
+        })
+    }
+
+    return s.render(records, func() {
+        if len(feeds) == 0 {
+            fmt.Println("All feeds are healthy")
+            return
+        }
+
+        for _, feed := range feeds {
+            lastSuccess := "never"
+            if feed.LastSuccessAt.Valid {
+                lastSuccess = feed.LastSuccessAt.Time.String()
+            }
+            fmt.Printf("Feed Name: %s\n", feed.Name)
+            fmt.Printf("Feed URL: %s\n", feed.Url)
+            fmt.Printf("Consecutive failures: %d\n", feed.ConsecutiveFailures)
+            if feed.LastError.Valid {
+                fmt.Printf("Last error: %s\n", feed.LastError.String)
+            }
+            fmt.Printf("Last success: %s\n", lastSuccess)
+            if feed.ParseWarning.Valid {
+                fmt.Printf("Parsed leniently: %s\n", feed.ParseWarning.String)
+            }
+            nextFetch := "as soon as possible"
+            if feed.NextFetchAt.Valid {
+                nextFetch = feed.NextFetchAt.Time.String()
+            }
+            fmt.Printf("Next fetch: %s\n\n", nextFetch)
+        }
+    })
 }
 
 func handlerFollow(s *state, cmd command, user database.User) error {
@@ -198,12 +566,21 @@ func handlerFollow(s *state, cmd command, user database.User) error {
     }
 
     feed, err := s.DBQueries.GetFeedByURL(context.Background(), feedURL)
+    if errors.Is(err, sql.ErrNoRows) {
+        // The URL may be the website of a feed that is stored under its
+        // feed URL.
+        discovered, discoverErr := discoverFeed(context.Background(), s.HTTPClient, feedURL)
+        if discoverErr == nil && discovered.FeedURL != feedURL {
+            printDiscovery(s, feedURL, discovered)
+            feed, err = s.DBQueries.GetFeedByURL(context.Background(), discovered.FeedURL)
+        }
+    }
     if err != nil {
         return fmt.Errorf("feed not found with URL %s: %v", feedURL, err)
     }
 
     followID := uuid.New()
-    now := time.Now()
+    now := time.Now().UTC()
     follow, err := s.DBQueries.CreateFeedFollow(context.Background(), database.CreateFeedFollowParams{
         ID:        followID,
         CreatedAt: now,
@@ -215,8 +592,18 @@ func handlerFollow(s *state, cmd command, user database.User) error {
         return fmt.Errorf("error following feed: %v", err)
     }
 
-    fmt.Printf("Now following '%s' as user '%s'\n", follow.FeedName, follow.UserName)
-    return nil
+    record := followRecord{
+        FeedID:     feed.ID,
+        FeedName:   follow.FeedName,
+        FeedURL:    feed.Url,
+        SiteURL:    nullableString(feed.SiteUrl),
+        Folder:     nullableString(follow.Folder),
+        UserName:   follow.UserName,
+        FollowedAt: follow.CreatedAt.UTC(),
+    }
+    return s.renderOne(record, func() {
+        fmt.Printf("Now following '%s' as user '%s'\n", follow.FeedName, follow.UserName)
+    })
 }
 
 func handlerFollowing(s *state, cmd command, user database.User) error {
@@ -231,16 +618,30 @@ func handlerFollowing(s *state, cmd command, user database.User) error {
         return fmt.Errorf("error getting followed feeds: %v", err)
     }
 
-    if len(feedFollows) == 0 {
-        fmt.Printf("User '%s' is not following any feeds\n", currentUser)
-        return nil
-    }
-
-    fmt.Printf("Feeds followed by '%s':\n", currentUser)
+    records := make([]followRecord, 0, len(feedFollows))
     for _, follow := range feedFollows {
-        fmt.Printf("* %s\n", follow.FeedName)
+        records = append(records, followRecord{
+            FeedID:     follow.FeedID,
+            FeedName:   follow.FeedName,
+            FeedURL:    follow.FeedUrl,
+            SiteURL:    nullableString(follow.SiteUrl),
+            Folder:     nullableString(follow.Folder),
+            UserName:   follow.UserName,
+            FollowedAt: follow.CreatedAt.UTC(),
+        })
     }
-    return nil
+
+    return s.render(records, func() {
+        if len(records) == 0 {
+            fmt.Printf("User '%s' is not following any feeds\n", currentUser)
+            return
+        }
+
+        fmt.Printf("Feeds followed by '%s':\n", currentUser)
+        for _, follow := range records {
+            fmt.Printf("* %s\n", follow.FeedName)
+        }
+    })
 }
 
 
@@ -263,30 +664,443 @@ func handlerUnfollow(s *state, cmd command, user database.User) error {
 }
 
 
+// handlerBrowse lists unread posts of the followed feeds:
+// browse [limit] [--all] [--feed url|name] [--since date] [--until date]
+// [--search text] [--sort newest|oldest|feed] [--offset n | --after post-id]
 func handlerBrowse(s *state, cmd command, user database.User) error {
+    args, includeRead := extractFlag(cmd.Args, "--all")
+    args, feed, err := extractFlagValue(args, "--feed")
+    if err != nil {
+        return err
+    }
+    args, since, err := extractFlagValue(args, "--since")
+    if err != nil {
+        return err
+    }
+    args, until, err := extractFlagValue(args, "--until")
+    if err != nil {
+        return err
+    }
+    args, search, err := extractFlagValue(args, "--search")
+    if err != nil {
+        return err
+    }
+    args, sort, err := extractFlagValue(args, "--sort")
+    if err != nil {
+        return err
+    }
+    args, offsetArg, err := extractFlagValue(args, "--offset")
+    if err != nil {
+        return err
+    }
+    args, afterArg, err := extractFlagValue(args, "--after")
+    if err != nil {
+        return err
+    }
+
     limit := 2
-    if len(cmd.Args) > 0 {
-        var err error
-        limit, err = strconv.Atoi(cmd.Args[0])
+    if len(args) > 0 {
+        limit, err = strconv.Atoi(args[0])
+        if err != nil || limit < 1 || limit > math.MaxInt32 {
+            return fmt.Errorf("invalid limit: %s", args[0])
+        }
+    }
+
+    params := database.BrowsePostsParams{
+        UserID:      user.ID,
+        IncludeRead: includeRead,
+        Feed:        sql.NullString{String: feed, Valid: feed != ""},
+        Search:      sql.NullString{String: search, Valid: search != ""},
+        Sort:        "newest",
+        Limit:       int32(limit),
+    }
+    for _, date := range []struct {
+        flag  string
+        value string
+        dest  *sql.NullTime
+    }{{"--since", since, &params.Since}, {"--until", until, &params.Until}} {
+        if date.value == "" {
+            continue
+        }
+        t, err := parsePubDate(date.value)
         if err != nil {
-            return fmt.Errorf("invalid limit: %v", err)
+            return fmt.Errorf("invalid %s date: %v", date.flag, err)
+        }
+        *date.dest = sql.NullTime{Time: t, Valid: true}
+    }
+    switch sort {
+    case "":
+    case "newest", "oldest", "feed":
+        params.Sort = sort
+    default:
+        return fmt.Errorf("invalid sort order %q, use newest, oldest or feed", sort)
+    }
+    if offsetArg != "" && afterArg != "" {
+        return fmt.Errorf("use either --offset or --after")
+    }
+    if offsetArg != "" {
+        offset, err := strconv.Atoi(offsetArg)
+        if err != nil || offset < 0 || offset > math.MaxInt32 {
+            return fmt.Errorf("invalid offset: %s", offsetArg)
         }
+        params.Offset = int32(offset)
+    }
+    if afterArg != "" {
+        after, err := uuid.Parse(afterArg)
+        if err != nil {
+            return fmt.Errorf("invalid post ID: %v", err)
+        }
+        followed, err := s.DBQueries.IsPostFollowed(context.Background(), database.IsPostFollowedParams{
+            ID:     after,
+            UserID: user.ID,
+        })
+        if err != nil {
+            return fmt.Errorf("error looking up post %s: %v", after, err)
+        }
+        if !followed {
+            return fmt.Errorf("invalid --after: post %s is not in a feed you follow", after)
+        }
+        params.After = uuid.NullUUID{UUID: after, Valid: true}
     }
 
-    posts, err := s.DBQueries.GetPostsForUser(context.Background(), database.GetPostsForUserParams{
-        Name:  user.Name,
-        Limit: int32(limit),
-    })
+    posts, err := s.DBQueries.BrowsePosts(context.Background(), params)
     if err != nil {
         return fmt.Errorf("error getting posts for user: %v", err)
     }
 
+    records := make([]postRecord, 0, len(posts))
+    enclosures := make([][]database.PostEnclosure, 0, len(posts))
     for _, post := range posts {
-        fmt.Printf("Title: %s\n", post.Title)
-        fmt.Printf("URL: %s\n", post.Url)
-        fmt.Printf("Description: %s\n", post.Description.String)
-        fmt.Printf("Published At: %s\n\n", post.PublishedAt.Time)
+        postEnclosures, err := s.DBQueries.GetPostEnclosures(context.Background(), post.ID)
+        if err != nil {
+            return fmt.Errorf("error getting enclosures of post: %v", err)
+        }
+        enclosures = append(enclosures, postEnclosures)
+
+        record := postRecord{
+            ID:                   post.ID,
+            Title:                post.Title,
+            URL:                  post.Url,
+            FeedName:             post.FeedName,
+            Author:               nullableString(post.Author),
+            Description:          nullableString(post.Description),
+            PublishedAt:          nullableTime(post.PublishedAt),
+            PublishedAtEstimated: post.PublishedAtEstimated,
+            ReadAt:               nullableTime(post.ReadAt),
+            Enclosures:           make([]enclosureRecord, 0, len(postEnclosures)),
+        }
+        for _, enclosure := range postEnclosures {
+            record.Enclosures = append(record.Enclosures, newEnclosureRecord(enclosure))
+        }
+        records = append(records, record)
+    }
+
+    err = s.render(records, func() {
+        if len(posts) == 0 {
+            fmt.Println("No posts found")
+            return
+        }
+        for i, post := range posts {
+            printPost(post, enclosures[i])
+        }
+    })
+    if err != nil {
+        return err
+    }
+
+    if len(posts) > 0 && len(posts) == limit {
+        s.notice("More posts: repeat with --after %s\n", posts[len(posts)-1].ID)
+    }
+    return nil
+}
+
+func printPost(post database.BrowsePostsRow, enclosures []database.PostEnclosure) {
+    fmt.Printf("ID: %s\n", post.ID)
+    fmt.Printf("Title: %s\n", post.Title)
+    fmt.Printf("URL: %s\n", post.Url)
+    fmt.Printf("Feed: %s\n", post.FeedName)
+    if post.Author.Valid {
+        fmt.Printf("Author: %s\n", post.Author.String)
+    }
+    fmt.Printf("Description: %s\n", post.Description.String)
+    fmt.Printf("Published At: %s\n", post.PublishedAt.Time)
+    if post.ReadAt.Valid {
+        fmt.Printf("Read At: %s\n", post.ReadAt.Time)
+    }
+    for _, enclosure := range enclosures {
+        fmt.Printf("%s: %s\n", enclosureLabel(enclosure.Kind), formatEnclosure(enclosure))
+    }
+    fmt.Println()
+}
+
+func enclosureLabel(kind string) string {
+    switch kind {
+    case enclosureImage:
+        return "Image"
+    case enclosureThumbnail:
+        return "Thumbnail"
+    default:
+        return "Media"
+    }
+}
+
+// formatEnclosure prints an enclosure URL followed by whatever is known
+// about the file, e.g. "https://example.com/ep1.mp3 (audio/mpeg, 24.3 MB, 45m12s, episode 12)".
+func formatEnclosure(enclosure database.PostEnclosure) string {
+    var details []string
+    if enclosure.MimeType.Valid {
+        details = append(details, enclosure.MimeType.String)
+    }
+    if enclosure.Length.Valid {
+        details = append(details, fmt.Sprintf("%.1f MB", float64(enclosure.Length.Int64)/1e6))
+    }
+    if enclosure.DurationSeconds.Valid {
+        details = append(details, (time.Duration(enclosure.DurationSeconds.Int32) * time.Second).String())
+    }
+    if enclosure.Episode.Valid {
+        details = append(details, fmt.Sprintf("episode %d", enclosure.Episode.Int32))
+    }
+    if len(details) == 0 {
+        return enclosure.Url
+    }
+    return fmt.Sprintf("%s (%s)", enclosure.Url, strings.Join(details, ", "))
+}
+
+func handlerRead(s *state, cmd command, user database.User) error {
+    if len(cmd.Args) < 1 {
+        return fmt.Errorf("enter the ID of the post to mark as read")
+    }
+    postID, err := uuid.Parse(cmd.Args[0])
+    if err != nil {
+        return fmt.Errorf("invalid post ID: %v", err)
+    }
+
+    err = s.DBQueries.MarkPostRead(context.Background(), database.MarkPostReadParams{
+        UserID: user.ID,
+        PostID: postID,
+        ReadAt: time.Now().UTC(),
+    })
+    if isForeignKeyViolation(err) {
+        return fmt.Errorf("post %s not found", postID)
+    }
+    if err != nil {
+        return fmt.Errorf("error marking post as read: %v", err)
+    }
+
+    fmt.Printf("Marked post %s as read\n", postID)
+    return nil
+}
+
+func handlerUnread(s *state, cmd command, user database.User) error {
+    if len(cmd.Args) < 1 {
+        return fmt.Errorf("enter the ID of the post to mark as unread")
+    }
+    postID, err := uuid.Parse(cmd.Args[0])
+    if err != nil {
+        return fmt.Errorf("invalid post ID: %v", err)
+    }
+
+    rows, err := s.DBQueries.MarkPostUnread(context.Background(), database.MarkPostUnreadParams{
+        UserID: user.ID,
+        PostID: postID,
+    })
+    if err != nil {
+        return fmt.Errorf("error marking post as unread: %v", err)
+    }
+    if rows == 0 {
+        return fmt.Errorf("post %s is not marked as read", postID)
+    }
+
+    fmt.Printf("Marked post %s as unread\n", postID)
+    return nil
+}
+
+// handlerMarkAllRead marks every post of the followed feeds as read, or only
+// those of the feed given with --feed or published before --before.
+func handlerMarkAllRead(s *state, cmd command, user database.User) error {
+    args, feedURL, err := extractFlagValue(cmd.Args, "--feed")
+    if err != nil {
+        return err
+    }
+    args, beforeArg, err := extractFlagValue(args, "--before")
+    if err != nil {
+        return err
+    }
+    if len(args) > 0 {
+        return fmt.Errorf("unexpected argument %q, usage: markall-read [--feed url] [--before date]", args[0])
     }
 
+    var before sql.NullTime
+    if beforeArg != "" {
+        t, err := parsePubDate(beforeArg)
+        if err != nil {
+            return fmt.Errorf("invalid --before date: %v", err)
+        }
+        before = sql.NullTime{Time: t, Valid: true}
+    }
+
+    rows, err := s.DBQueries.MarkPostsRead(context.Background(), database.MarkPostsReadParams{
+        ReadAt:  time.Now().UTC(),
+        UserID:  user.ID,
+        FeedUrl: sql.NullString{String: feedURL, Valid: feedURL != ""},
+        Before:  before,
+    })
+    if err != nil {
+        return fmt.Errorf("error marking posts as read: %v", err)
+    }
+
+    fmt.Printf("Marked %d posts as read\n", rows)
     return nil
-}
\ No newline at end of file
+}
+
+func handlerStar(s *state, cmd command, user database.User) error {
+    if len(cmd.Args) < 1 {
+        return fmt.Errorf("enter the ID of the post to star")
+    }
+    postID, err := uuid.Parse(cmd.Args[0])
+    if err != nil {
+        return fmt.Errorf("invalid post ID: %v", err)
+    }
+
+    rows, err := s.DBQueries.StarPost(context.Background(), database.StarPostParams{
+        UserID:  user.ID,
+        ID:      postID,
+        SavedAt: time.Now().UTC(),
+    })
+    if err != nil {
+        return fmt.Errorf("error starring post: %v", err)
+    }
+    if rows == 0 {
+        return fmt.Errorf("post %s not found", postID)
+    }
+
+    fmt.Printf("Starred post %s\n", postID)
+    return nil
+}
+
+func handlerUnstar(s *state, cmd command, user database.User) error {
+    if len(cmd.Args) < 1 {
+        return fmt.Errorf("enter the ID of the post to unstar")
+    }
+    postID, err := uuid.Parse(cmd.Args[0])
+    if err != nil {
+        return fmt.Errorf("invalid post ID: %v", err)
+    }
+
+    rows, err := s.DBQueries.UnstarPost(context.Background(), database.UnstarPostParams{
+        UserID: user.ID,
+        PostID: postID,
+    })
+    if err != nil {
+        return fmt.Errorf("error unstarring post: %v", err)
+    }
+    if rows == 0 {
+        return fmt.Errorf("post %s is not starred", postID)
+    }
+
+    fmt.Printf("Unstarred post %s\n", postID)
+    return nil
+}
+
+func handlerStarred(s *state, cmd command, user database.User) error {
+    posts, err := s.DBQueries.GetStarredPosts(context.Background(), user.ID)
+    if err != nil {
+        return fmt.Errorf("error getting starred posts: %v", err)
+    }
+
+    records := make([]starredPostRecord, 0, len(posts))
+    for _, post := range posts {
+        records = append(records, starredPostRecord{
+            PostID:      post.PostID,
+            Title:       post.Title,
+            URL:         post.Url,
+            FeedName:    post.FeedName,
+            Author:      nullableString(post.Author),
+            Description: nullableString(post.Description),
+            PublishedAt: nullableTime(post.PublishedAt),
+            StarredAt:   post.SavedAt.UTC(),
+        })
+    }
+
+    return s.render(records, func() {
+        if len(posts) == 0 {
+            fmt.Println("No starred posts")
+            return
+        }
+
+        for _, post := range posts {
+            fmt.Printf("ID: %s\n", post.PostID)
+            fmt.Printf("Title: %s\n", post.Title)
+            fmt.Printf("URL: %s\n", post.Url)
+            fmt.Printf("Feed: %s\n", post.FeedName)
+            if post.Author.Valid {
+                fmt.Printf("Author: %s\n", post.Author.String)
+            }
+            fmt.Printf("Description: %s\n", post.Description.String)
+            fmt.Printf("Published At: %s\n", post.PublishedAt.Time)
+            fmt.Printf("Starred At: %s\n\n", post.SavedAt)
+        }
+    })
+}
+
+// handlerSearch runs a full-text search over the posts of the followed feeds:
+// search <query> [--limit n] [--all-feeds]
+func handlerSearch(s *state, cmd command, user database.User) error {
+    args, allFeeds := extractFlag(cmd.Args, "--all-feeds")
+    args, limitArg, err := extractFlagValue(args, "--limit")
+    if err != nil {
+        return err
+    }
+    query := strings.TrimSpace(strings.Join(args, " "))
+    if query == "" {
+        return fmt.Errorf("enter a search query")
+    }
+
+    limit := 10
+    if limitArg != "" {
+        limit, err = strconv.Atoi(limitArg)
+        if err != nil || limit < 1 || limit > math.MaxInt32 {
+            return fmt.Errorf("invalid limit: %s", limitArg)
+        }
+    }
+
+    results, err := s.DBQueries.SearchPosts(context.Background(), database.SearchPostsParams{
+        Query:    query,
+        AllFeeds: allFeeds,
+        UserID:   user.ID,
+        Limit:    int32(limit),
+    })
+    if err != nil {
+        return fmt.Errorf("error searching posts: %v", err)
+    }
+
+    records := make([]searchResultRecord, 0, len(results))
+    for _, result := range results {
+        records = append(records, searchResultRecord{
+            ID:          result.ID,
+            Title:       result.Title,
+            URL:         result.Url,
+            FeedName:    result.FeedName,
+            PublishedAt: nullableTime(result.PublishedAt),
+            Rank:        result.Rank,
+            Headline:    strings.Join(strings.Fields(result.Headline), " "),
+        })
+    }
+
+    return s.render(records, func() {
+        if len(records) == 0 {
+            fmt.Printf("No posts match '%s'\n", query)
+            return
+        }
+
+        for _, result := range results {
+            fmt.Printf("ID: %s\n", result.ID)
+            fmt.Printf("Title: %s\n", result.Title)
+            fmt.Printf("URL: %s\n", result.Url)
+            fmt.Printf("Feed: %s\n", result.FeedName)
+            fmt.Printf("Published At: %s\n", result.PublishedAt.Time)
+            fmt.Printf("Rank: %.3f\n", result.Rank)
+            fmt.Printf("Match: %s\n\n", strings.Join(strings.Fields(result.Headline), " "))
+        }
+    })
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/andybalholm/brotli"
+
+	config "github.com/KrishKoria/GatorConfig"
+)
+
+// Defaults for the settings of config.HTTPConfig.
+const (
+	defaultUserAgent      = "gator/1.0 (+https://github.com/KrishKoria/Gator)"
+	defaultHTTPTimeout    = 30 * time.Second
+	defaultConnectTimeout = 10 * time.Second
+	defaultReadTimeout    = 15 * time.Second
+	defaultMaxBodyBytes   = 10 << 20
+	defaultMaxRedirects   = 5
+)
+
+// feedClient is the HTTP client shared by every fetch, so connections are
+// reused across feeds. It negotiates gzip and brotli compression itself and
+// caps the size of the bodies it reads.
+type feedClient struct {
+	client       *http.Client
+	userAgent    string
+	readTimeout  time.Duration
+	maxBodyBytes int64
+}
+
+// bodyTooLargeError is returned by readBody when a response is bigger than
+// the configured maximum body size.
+type bodyTooLargeError struct {
+	Limit int64
+}
+
+func (e *bodyTooLargeError) Error() string {
+	return fmt.Sprintf("response body exceeds %d bytes", e.Limit)
+}
+
+// newFeedClient builds the HTTP client from the configuration. The connect
+// timeout bounds dialing and the TLS handshake, the read timeout the wait for
+// response headers and for each chunk of the body, and the overall timeout
+// the whole request including reading the body.
+func newFeedClient(cfg config.HTTPConfig) (*feedClient, error) {
+	timeout, err := configDuration("timeout", cfg.Timeout, defaultHTTPTimeout)
+	if err != nil {
+		return nil, err
+	}
+	connectTimeout, err := configDuration("connect_timeout", cfg.ConnectTimeout, defaultConnectTimeout)
+	if err != nil {
+		return nil, err
+	}
+	readTimeout, err := configDuration("read_timeout", cfg.ReadTimeout, defaultReadTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	userAgent := cfg.UserAgent
+	if userAgent == "" {
+		userAgent = defaultUserAgent
+	}
+	maxBodyBytes := cfg.MaxBodyBytes
+	if maxBodyBytes <= 0 {
+		maxBodyBytes = defaultMaxBodyBytes
+	}
+	maxRedirects := cfg.MaxRedirects
+	if maxRedirects <= 0 {
+		maxRedirects = defaultMaxRedirects
+	}
+
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   connectTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   connectTimeout,
+		ResponseHeaderTimeout: readTimeout,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   4,
+		IdleConnTimeout:       90 * time.Second,
+		// Content encodings are negotiated in get and decoded in readBody,
+		// which also handles brotli.
+		DisableCompression: true,
+	}
+	return &feedClient{
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) > maxRedirects {
+					return fmt.Errorf("stopped after %d redirects", maxRedirects)
+				}
+				return nil
+			},
+		},
+		userAgent:    userAgent,
+		readTimeout:  readTimeout,
+		maxBodyBytes: maxBodyBytes,
+	}, nil
+}
+
+// configDuration parses a duration setting, returning def when it is unset.
+func configDuration(name, value string, def time.Duration) (time.Duration, error) {
+	if value == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid http.%s %q in config", name, value)
+	}
+	return d, nil
+}
+
+// get sends a GET request with the given extra headers.
+func (c *feedClient) get(ctx context.Context, rawURL string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	req.Header.Set("Accept-Encoding", "gzip, br")
+	return c.client.Do(req)
+}
+
+// readBody reads and decodes a response body. The size limit applies to the
+// decoded body, so compressed responses can't expand past it either.
+func (c *feedClient) readBody(resp *http.Response) ([]byte, error) {
+	if resp.ContentLength > c.maxBodyBytes {
+		return nil, &bodyTooLargeError{Limit: c.maxBodyBytes}
+	}
+
+	body := newIdleTimeoutReader(resp.Body, c.readTimeout)
+	defer body.stop()
+
+	var reader io.Reader = body
+	switch encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))); encoding {
+	case "", "identity":
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode gzip body: %w", err)
+		}
+		defer gz.Close()
+		reader = gz
+	case "br":
+		reader = brotli.NewReader(body)
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(reader, c.maxBodyBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if int64(len(data)) > c.maxBodyBytes {
+		return nil, &bodyTooLargeError{Limit: c.maxBodyBytes}
+	}
+	return data, nil
+}
+
+// readTimeoutError is returned when a response body stalls for longer than
+// the read timeout.
+type readTimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e *readTimeoutError) Error() string {
+	return fmt.Sprintf("no data received for %s", e.Timeout)
+}
+
+// idleTimeoutReader reads a response body, closing it when no data arrives
+// for timeout so that a server trickling the body can't hold a fetch until
+// the overall timeout.
+type idleTimeoutReader struct {
+	body    io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+	expired atomic.Bool
+}
+
+func newIdleTimeoutReader(body io.ReadCloser, timeout time.Duration) *idleTimeoutReader {
+	r := &idleTimeoutReader{body: body, timeout: timeout}
+	r.timer = time.AfterFunc(timeout, func() {
+		r.expired.Store(true)
+		body.Close()
+	})
+	return r
+}
+
+func (r *idleTimeoutReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	if r.expired.Load() {
+		return n, &readTimeoutError{Timeout: r.timeout}
+	}
+	if n > 0 {
+		r.timer.Reset(r.timeout)
+	}
+	return n, err
+}
+
+func (r *idleTimeoutReader) stop() {
+	r.timer.Stop()
+}
@@ -12,6 +12,18 @@ const configFileName = ".gatorconfig.json"
 type Config struct {
     DBURL          string `json:"db_url"`
     CurrentUserName string `json:"current_user_name"`
+    HTTP           HTTPConfig `json:"http"`
+}
+
+// HTTPConfig tunes the HTTP client used to fetch feeds. Durations are strings
+// like "30s"; zero values select the defaults.
+type HTTPConfig struct {
+    UserAgent      string `json:"user_agent,omitempty"`
+    Timeout        string `json:"timeout,omitempty"`
+    ConnectTimeout string `json:"connect_timeout,omitempty"`
+    ReadTimeout    string `json:"read_timeout,omitempty"`
+    MaxBodyBytes   int64  `json:"max_body_bytes,omitempty"`
+    MaxRedirects   int    `json:"max_redirects,omitempty"`
 }
 
 func Read() (*Config, error) {
@@ -7,31 +7,100 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const claimFeedsToFetch = `-- name: ClaimFeedsToFetch :many
+UPDATE feeds
+SET lease_owner = $1::text,
+lease_expires_at = NOW() + ($2::int * INTERVAL '1 second')
+WHERE id IN (
+  SELECT id FROM feeds
+  WHERE (lease_expires_at IS NULL OR lease_expires_at < NOW())
+  AND (next_fetch_at IS NULL OR next_fetch_at <= NOW())
+  ORDER BY last_fetched_at ASC NULLS FIRST
+  LIMIT $3
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, lease_owner, lease_expires_at, etag, last_modified, consecutive_failures, last_error, last_success_at, next_fetch_at, fetch_interval_seconds, site_url, parse_warning
+`
+
+type ClaimFeedsToFetchParams struct {
+	LeaseOwner   string
+	LeaseSeconds int32
+	BatchSize    int32
+}
+
+// Leases the stalest unleased feeds that are due to one aggregator instance.
+// SKIP LOCKED lets concurrent instances claim disjoint batches, and an expired
+// lease (from a crashed instance) makes the feed claimable again.
+func (q *Queries) ClaimFeedsToFetch(ctx context.Context, arg ClaimFeedsToFetchParams) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, claimFeedsToFetch, arg.LeaseOwner, arg.LeaseSeconds, arg.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.LeaseOwner,
+			&i.LeaseExpiresAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.ConsecutiveFailures,
+			&i.LastError,
+			&i.LastSuccessAt,
+			&i.NextFetchAt,
+			&i.FetchIntervalSeconds,
+			&i.SiteUrl,
+			&i.ParseWarning,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createFeed = `-- name: CreateFeed :one
-INSERT INTO feeds (id, created_at, updated_at, name, url, user_id)
+INSERT INTO feeds (id, created_at, updated_at, name, url, user_id, fetch_interval_seconds)
 VALUES (
     $1,
     $2,
     $3,
     $4,
     $5,
-    $6
+    $6,
+    $7
 )
-RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, lease_owner, lease_expires_at, etag, last_modified, consecutive_failures, last_error, last_success_at, next_fetch_at, fetch_interval_seconds, site_url, parse_warning
 `
 
 type CreateFeedParams struct {
-	ID        uuid.UUID
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	Name      string
-	Url       string
-	UserID    uuid.UUID
+	ID                   uuid.UUID
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+	Name                 string
+	Url                  string
+	UserID               uuid.UUID
+	FetchIntervalSeconds sql.NullInt32
 }
 
 func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, error) {
@@ -42,6 +111,7 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		arg.Name,
 		arg.Url,
 		arg.UserID,
+		arg.FetchIntervalSeconds,
 	)
 	var i Feed
 	err := row.Scan(
@@ -52,18 +122,29 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.LeaseOwner,
+		&i.LeaseExpiresAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.ConsecutiveFailures,
+		&i.LastError,
+		&i.LastSuccessAt,
+		&i.NextFetchAt,
+		&i.FetchIntervalSeconds,
+		&i.SiteUrl,
+		&i.ParseWarning,
 	)
 	return i, err
 }
 
 const createFeedFollow = `-- name: CreateFeedFollow :one
 WITH inserted_follow AS (
-  INSERT INTO feed_follows (id, created_at, updated_at, user_id, feed_id)
-  VALUES ($1, $2, $3, $4, $5)
-  RETURNING id, created_at, updated_at, user_id, feed_id
+  INSERT INTO feed_follows (id, created_at, updated_at, user_id, feed_id, folder)
+  VALUES ($1, $2, $3, $4, $5, $6)
+  RETURNING id, created_at, updated_at, user_id, feed_id, folder
 )
 SELECT 
-  inserted_follow.id, inserted_follow.created_at, inserted_follow.updated_at, inserted_follow.user_id, inserted_follow.feed_id,
+  inserted_follow.id, inserted_follow.created_at, inserted_follow.updated_at, inserted_follow.user_id, inserted_follow.feed_id, inserted_follow.folder,
   users.name AS user_name,
   feeds.name AS feed_name
 FROM inserted_follow
@@ -77,6 +158,7 @@ type CreateFeedFollowParams struct {
 	UpdatedAt time.Time
 	UserID    uuid.UUID
 	FeedID    uuid.UUID
+	Folder    sql.NullString
 }
 
 type CreateFeedFollowRow struct {
@@ -85,6 +167,7 @@ type CreateFeedFollowRow struct {
 	UpdatedAt time.Time
 	UserID    uuid.UUID
 	FeedID    uuid.UUID
+	Folder    sql.NullString
 	UserName  string
 	FeedName  string
 }
@@ -96,6 +179,7 @@ func (q *Queries) CreateFeedFollow(ctx context.Context, arg CreateFeedFollowPara
 		arg.UpdatedAt,
 		arg.UserID,
 		arg.FeedID,
+		arg.Folder,
 	)
 	var i CreateFeedFollowRow
 	err := row.Scan(
@@ -104,6 +188,7 @@ func (q *Queries) CreateFeedFollow(ctx context.Context, arg CreateFeedFollowPara
 		&i.UpdatedAt,
 		&i.UserID,
 		&i.FeedID,
+		&i.Folder,
 		&i.UserName,
 		&i.FeedName,
 	)
@@ -138,7 +223,7 @@ func (q *Queries) DeleteFeedFollowByUserAndFeedURL(ctx context.Context, arg Dele
 }
 
 const getFeedByURL = `-- name: GetFeedByURL :one
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, lease_owner, lease_expires_at, etag, last_modified, consecutive_failures, last_error, last_success_at, next_fetch_at, fetch_interval_seconds, site_url, parse_warning FROM feeds
 WHERE url = $1
 LIMIT 1
 `
@@ -154,15 +239,28 @@ func (q *Queries) GetFeedByURL(ctx context.Context, url string) (Feed, error) {
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.LeaseOwner,
+		&i.LeaseExpiresAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.ConsecutiveFailures,
+		&i.LastError,
+		&i.LastSuccessAt,
+		&i.NextFetchAt,
+		&i.FetchIntervalSeconds,
+		&i.SiteUrl,
+		&i.ParseWarning,
 	)
 	return i, err
 }
 
 const getFeedFollowsForUser = `-- name: GetFeedFollowsForUser :many
 SELECT 
-  feed_follows.id, feed_follows.created_at, feed_follows.updated_at, feed_follows.user_id, feed_follows.feed_id,
+  feed_follows.id, feed_follows.created_at, feed_follows.updated_at, feed_follows.user_id, feed_follows.feed_id, feed_follows.folder,
   users.name AS user_name,
-  feeds.name AS feed_name
+  feeds.name AS feed_name,
+  feeds.url AS feed_url,
+  feeds.site_url
 FROM feed_follows
 JOIN users ON feed_follows.user_id = users.id
 JOIN feeds ON feed_follows.feed_id = feeds.id
@@ -176,8 +274,11 @@ type GetFeedFollowsForUserRow struct {
 	UpdatedAt time.Time
 	UserID    uuid.UUID
 	FeedID    uuid.UUID
+	Folder    sql.NullString
 	UserName  string
 	FeedName  string
+	FeedUrl   string
+	SiteUrl   sql.NullString
 }
 
 func (q *Queries) GetFeedFollowsForUser(ctx context.Context, userID uuid.UUID) ([]GetFeedFollowsForUserRow, error) {
@@ -195,8 +296,11 @@ func (q *Queries) GetFeedFollowsForUser(ctx context.Context, userID uuid.UUID) (
 			&i.UpdatedAt,
 			&i.UserID,
 			&i.FeedID,
+			&i.Folder,
 			&i.UserName,
 			&i.FeedName,
+			&i.FeedUrl,
+			&i.SiteUrl,
 		); err != nil {
 			return nil, err
 		}
@@ -212,15 +316,20 @@ func (q *Queries) GetFeedFollowsForUser(ctx context.Context, userID uuid.UUID) (
 }
 
 const getFeedsWithUsers = `-- name: GetFeedsWithUsers :many
-SELECT feeds.name AS feed_name, feeds.url, users.name AS user_name
+SELECT feeds.id, feeds.created_at, feeds.name AS feed_name, feeds.url, feeds.site_url, feeds.fetch_interval_seconds, feeds.last_fetched_at, users.name AS user_name
 FROM feeds
 JOIN users ON feeds.user_id = users.id
 `
 
 type GetFeedsWithUsersRow struct {
-	FeedName string
-	Url      string
-	UserName string
+	ID                   uuid.UUID
+	CreatedAt            time.Time
+	FeedName             string
+	Url                  string
+	SiteUrl              sql.NullString
+	FetchIntervalSeconds sql.NullInt32
+	LastFetchedAt        sql.NullTime
+	UserName             string
 }
 
 func (q *Queries) GetFeedsWithUsers(ctx context.Context) ([]GetFeedsWithUsersRow, error) {
@@ -232,7 +341,16 @@ func (q *Queries) GetFeedsWithUsers(ctx context.Context) ([]GetFeedsWithUsersRow
 	var items []GetFeedsWithUsersRow
 	for rows.Next() {
 		var i GetFeedsWithUsersRow
-		if err := rows.Scan(&i.FeedName, &i.Url, &i.UserName); err != nil {
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.FeedName,
+			&i.Url,
+			&i.SiteUrl,
+			&i.FetchIntervalSeconds,
+			&i.LastFetchedAt,
+			&i.UserName,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -246,25 +364,54 @@ func (q *Queries) GetFeedsWithUsers(ctx context.Context) ([]GetFeedsWithUsersRow
 	return items, nil
 }
 
-const getNextFeedToFetch = `-- name: GetNextFeedToFetch :one
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds
-ORDER BY last_fetched_at ASC NULLS FIRST
-LIMIT 1
+const getUnhealthyFeeds = `-- name: GetUnhealthyFeeds :many
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, lease_owner, lease_expires_at, etag, last_modified, consecutive_failures, last_error, last_success_at, next_fetch_at, fetch_interval_seconds, site_url, parse_warning FROM feeds
+WHERE consecutive_failures > 0 OR parse_warning IS NOT NULL
+ORDER BY consecutive_failures DESC, name ASC
 `
 
-func (q *Queries) GetNextFeedToFetch(ctx context.Context) (Feed, error) {
-	row := q.db.QueryRowContext(ctx, getNextFeedToFetch)
-	var i Feed
-	err := row.Scan(
-		&i.ID,
-		&i.CreatedAt,
-		&i.UpdatedAt,
-		&i.Name,
-		&i.Url,
-		&i.UserID,
-		&i.LastFetchedAt,
-	)
-	return i, err
+// Feeds whose last fetches failed, or that could only be parsed in lenient
+// mode.
+func (q *Queries) GetUnhealthyFeeds(ctx context.Context) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, getUnhealthyFeeds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.LeaseOwner,
+			&i.LeaseExpiresAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.ConsecutiveFailures,
+			&i.LastError,
+			&i.LastSuccessAt,
+			&i.NextFetchAt,
+			&i.FetchIntervalSeconds,
+			&i.SiteUrl,
+			&i.ParseWarning,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
 const markFeedFetched = `-- name: MarkFeedFetched :one
@@ -272,7 +419,7 @@ UPDATE feeds
 SET last_fetched_at = NOW(),
 updated_at = NOW()
 WHERE id = $1
-RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, lease_owner, lease_expires_at, etag, last_modified, consecutive_failures, last_error, last_success_at, next_fetch_at, fetch_interval_seconds, site_url, parse_warning
 `
 
 func (q *Queries) MarkFeedFetched(ctx context.Context, id uuid.UUID) (Feed, error) {
@@ -286,6 +433,148 @@ func (q *Queries) MarkFeedFetched(ctx context.Context, id uuid.UUID) (Feed, erro
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.LeaseOwner,
+		&i.LeaseExpiresAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.ConsecutiveFailures,
+		&i.LastError,
+		&i.LastSuccessAt,
+		&i.NextFetchAt,
+		&i.FetchIntervalSeconds,
+		&i.SiteUrl,
+		&i.ParseWarning,
 	)
 	return i, err
 }
+
+const recordFeedFailure = `-- name: RecordFeedFailure :exec
+UPDATE feeds
+SET consecutive_failures = consecutive_failures + 1,
+last_error = $1,
+next_fetch_at = NOW() + ($2::int * INTERVAL '1 second'),
+updated_at = NOW()
+WHERE id = $3
+`
+
+type RecordFeedFailureParams struct {
+	LastError    sql.NullString
+	RetrySeconds int32
+	ID           uuid.UUID
+}
+
+// The next attempt is scheduled with NOW(), like the comparison in
+// ClaimFeedsToFetch, so the time zone of the aggregator doesn't matter.
+func (q *Queries) RecordFeedFailure(ctx context.Context, arg RecordFeedFailureParams) error {
+	_, err := q.db.ExecContext(ctx, recordFeedFailure, arg.LastError, arg.RetrySeconds, arg.ID)
+	return err
+}
+
+const recordFeedSuccess = `-- name: RecordFeedSuccess :exec
+UPDATE feeds
+SET consecutive_failures = 0,
+last_error = NULL,
+last_success_at = NOW(),
+next_fetch_at = NOW() + ($1::int * INTERVAL '1 second'),
+updated_at = NOW()
+WHERE id = $2
+`
+
+type RecordFeedSuccessParams struct {
+	NextFetchSeconds sql.NullInt32
+	ID               uuid.UUID
+}
+
+// A null next_fetch_seconds makes the feed due on the next tick.
+func (q *Queries) RecordFeedSuccess(ctx context.Context, arg RecordFeedSuccessParams) error {
+	_, err := q.db.ExecContext(ctx, recordFeedSuccess, arg.NextFetchSeconds, arg.ID)
+	return err
+}
+
+const releaseFeedLease = `-- name: ReleaseFeedLease :exec
+UPDATE feeds
+SET lease_owner = NULL,
+lease_expires_at = NULL
+WHERE id = $1
+AND lease_owner = $2
+`
+
+type ReleaseFeedLeaseParams struct {
+	ID         uuid.UUID
+	LeaseOwner sql.NullString
+}
+
+func (q *Queries) ReleaseFeedLease(ctx context.Context, arg ReleaseFeedLeaseParams) error {
+	_, err := q.db.ExecContext(ctx, releaseFeedLease, arg.ID, arg.LeaseOwner)
+	return err
+}
+
+const updateFeedFetchInterval = `-- name: UpdateFeedFetchInterval :exec
+UPDATE feeds
+SET fetch_interval_seconds = $2,
+updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdateFeedFetchIntervalParams struct {
+	ID                   uuid.UUID
+	FetchIntervalSeconds sql.NullInt32
+}
+
+func (q *Queries) UpdateFeedFetchInterval(ctx context.Context, arg UpdateFeedFetchIntervalParams) error {
+	_, err := q.db.ExecContext(ctx, updateFeedFetchInterval, arg.ID, arg.FetchIntervalSeconds)
+	return err
+}
+
+const updateFeedParseWarning = `-- name: UpdateFeedParseWarning :exec
+UPDATE feeds
+SET parse_warning = $2,
+updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdateFeedParseWarningParams struct {
+	ID           uuid.UUID
+	ParseWarning sql.NullString
+}
+
+func (q *Queries) UpdateFeedParseWarning(ctx context.Context, arg UpdateFeedParseWarningParams) error {
+	_, err := q.db.ExecContext(ctx, updateFeedParseWarning, arg.ID, arg.ParseWarning)
+	return err
+}
+
+const updateFeedSiteURL = `-- name: UpdateFeedSiteURL :exec
+UPDATE feeds
+SET site_url = $2,
+updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdateFeedSiteURLParams struct {
+	ID      uuid.UUID
+	SiteUrl sql.NullString
+}
+
+func (q *Queries) UpdateFeedSiteURL(ctx context.Context, arg UpdateFeedSiteURLParams) error {
+	_, err := q.db.ExecContext(ctx, updateFeedSiteURL, arg.ID, arg.SiteUrl)
+	return err
+}
+
+const updateFeedValidators = `-- name: UpdateFeedValidators :exec
+UPDATE feeds
+SET etag = $2,
+last_modified = $3,
+updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdateFeedValidatorsParams struct {
+	ID           uuid.UUID
+	Etag         sql.NullString
+	LastModified sql.NullString
+}
+
+func (q *Queries) UpdateFeedValidators(ctx context.Context, arg UpdateFeedValidatorsParams) error {
+	_, err := q.db.ExecContext(ctx, updateFeedValidators, arg.ID, arg.Etag, arg.LastModified)
+	return err
+}
@@ -12,13 +12,24 @@ import (
 )
 
 type Feed struct {
-	ID            uuid.UUID
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	Name          string
-	Url           string
-	UserID        uuid.UUID
-	LastFetchedAt sql.NullTime
+	ID                   uuid.UUID
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+	Name                 string
+	Url                  string
+	UserID               uuid.UUID
+	LastFetchedAt        sql.NullTime
+	LeaseOwner           sql.NullString
+	LeaseExpiresAt       sql.NullTime
+	Etag                 sql.NullString
+	LastModified         sql.NullString
+	ConsecutiveFailures  int32
+	LastError            sql.NullString
+	LastSuccessAt        sql.NullTime
+	NextFetchAt          sql.NullTime
+	FetchIntervalSeconds sql.NullInt32
+	SiteUrl              sql.NullString
+	ParseWarning         sql.NullString
 }
 
 type FeedFollow struct {
@@ -27,17 +38,59 @@ type FeedFollow struct {
 	UpdatedAt time.Time
 	UserID    uuid.UUID
 	FeedID    uuid.UUID
+	Folder    sql.NullString
 }
 
 type Post struct {
-	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
+	ID                   uuid.UUID
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+	Title                string
+	Url                  string
+	Description          sql.NullString
+	PublishedAt          sql.NullTime
+	FeedID               uuid.UUID
+	PublishedAtEstimated bool
+	Guid                 sql.NullString
+	Author               sql.NullString
+	Content              sql.NullString
+	CommentsUrl          sql.NullString
+	DedupKey             string
+	SearchVector         interface{}
+}
+
+type PostCategory struct {
+	PostID uuid.UUID
+	Name   string
+}
+
+type PostEnclosure struct {
+	PostID          uuid.UUID
+	Url             string
+	Kind            string
+	MimeType        sql.NullString
+	Length          sql.NullInt64
+	DurationSeconds sql.NullInt32
+	Episode         sql.NullInt32
+}
+
+type PostRead struct {
+	UserID uuid.UUID
+	PostID uuid.UUID
+	ReadAt time.Time
+}
+
+type SavedPost struct {
+	UserID      uuid.UUID
+	PostID      uuid.UUID
+	SavedAt     time.Time
+	FeedName    string
 	Title       string
 	Url         string
 	Description sql.NullString
+	Content     sql.NullString
+	Author      sql.NullString
 	PublishedAt sql.NullTime
-	FeedID      uuid.UUID
 }
 
 type User struct {
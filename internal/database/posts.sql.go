@@ -11,27 +11,604 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
-const createPost = `-- name: CreatePost :one
-INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id)
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id
+const adoptPostGUID = `-- name: AdoptPostGUID :exec
+UPDATE posts
+SET guid = $1::text,
+dedup_key = $1::text
+WHERE feed_id = $2
+AND dedup_key = $3::text
+AND (guid IS NULL OR guid = $1::text)
+AND NOT EXISTS (
+  SELECT 1 FROM posts other
+  WHERE other.feed_id = $2 AND other.dedup_key = $1::text
+)
+`
+
+type AdoptPostGUIDParams struct {
+	Guid   string
+	FeedID uuid.UUID
+	Link   string
+}
+
+// Moves a post stored under its normalized link, before its feed gave it a
+// GUID or while the GUID was shared with other items, to the GUID. Nothing
+// changes when a post is already stored under the GUID.
+func (q *Queries) AdoptPostGUID(ctx context.Context, arg AdoptPostGUIDParams) error {
+	_, err := q.db.ExecContext(ctx, adoptPostGUID, arg.Guid, arg.FeedID, arg.Link)
+	return err
+}
+
+const browsePosts = `-- name: BrowsePosts :many
+WITH cursor AS (
+  SELECT coalesce(posts.published_at, posts.created_at) AS sort_at, posts.id, feeds.name AS feed_name
+  FROM posts
+  JOIN feeds ON posts.feed_id = feeds.id
+  WHERE posts.id = $7
+)
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.published_at_estimated, posts.guid, posts.author, posts.content, posts.comments_url, posts.dedup_key, feeds.name AS feed_name, post_reads.read_at
+FROM posts
+JOIN feeds ON posts.feed_id = feeds.id
+JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+LEFT JOIN post_reads ON post_reads.post_id = posts.id AND post_reads.user_id = feed_follows.user_id
+LEFT JOIN cursor ON TRUE
+WHERE feed_follows.user_id = $1
+AND ($2::boolean OR post_reads.post_id IS NULL)
+AND ($3::text IS NULL OR feeds.url = $3 OR feeds.name = $3)
+AND ($4::timestamp IS NULL OR posts.published_at >= $4)
+AND ($5::timestamp IS NULL OR posts.published_at < $5)
+AND ($6::text IS NULL
+  OR strpos(lower(posts.title), lower($6)) > 0
+  OR strpos(lower(posts.description), lower($6)) > 0
+  OR strpos(lower(posts.content), lower($6)) > 0)
+AND ($7::uuid IS NULL OR CASE $8::text
+  WHEN 'oldest' THEN (coalesce(posts.published_at, posts.created_at), posts.id) > (cursor.sort_at, cursor.id)
+  WHEN 'feed' THEN feeds.name > cursor.feed_name
+    OR (feeds.name = cursor.feed_name AND (coalesce(posts.published_at, posts.created_at), posts.id) < (cursor.sort_at, cursor.id))
+  ELSE (coalesce(posts.published_at, posts.created_at), posts.id) < (cursor.sort_at, cursor.id)
+END)
+ORDER BY
+  CASE WHEN $8::text = 'feed' THEN feeds.name END,
+  CASE WHEN $8::text = 'oldest' THEN coalesce(posts.published_at, posts.created_at) END,
+  CASE WHEN $8::text = 'oldest' THEN posts.id END,
+  coalesce(posts.published_at, posts.created_at) DESC,
+  posts.id DESC
+LIMIT $10
+OFFSET $9
+`
+
+type BrowsePostsParams struct {
+	UserID      uuid.UUID
+	IncludeRead bool
+	Feed        sql.NullString
+	Since       sql.NullTime
+	Until       sql.NullTime
+	Search      sql.NullString
+	After       uuid.NullUUID
+	Sort        string
+	Offset      int32
+	Limit       int32
+}
+
+type BrowsePostsRow struct {
+	ID                   uuid.UUID
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+	Title                string
+	Url                  string
+	Description          sql.NullString
+	PublishedAt          sql.NullTime
+	FeedID               uuid.UUID
+	PublishedAtEstimated bool
+	Guid                 sql.NullString
+	Author               sql.NullString
+	Content              sql.NullString
+	CommentsUrl          sql.NullString
+	DedupKey             string
+	FeedName             string
+	ReadAt               sql.NullTime
+}
+
+// Lists the posts of the feeds a user follows. Every filter is optional. Pages
+// are either skipped with offset or continue after the post given as after,
+// in the order selected by sort: newest, oldest or feed. Posts without a
+// publication date are ordered by the time they were stored.
+func (q *Queries) BrowsePosts(ctx context.Context, arg BrowsePostsParams) ([]BrowsePostsRow, error) {
+	rows, err := q.db.QueryContext(ctx, browsePosts,
+		arg.UserID,
+		arg.IncludeRead,
+		arg.Feed,
+		arg.Since,
+		arg.Until,
+		arg.Search,
+		arg.After,
+		arg.Sort,
+		arg.Offset,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []BrowsePostsRow
+	for rows.Next() {
+		var i BrowsePostsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.PublishedAtEstimated,
+			&i.Guid,
+			&i.Author,
+			&i.Content,
+			&i.CommentsUrl,
+			&i.DedupKey,
+			&i.FeedName,
+			&i.ReadAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const createPostCategory = `-- name: CreatePostCategory :exec
+INSERT INTO post_categories (post_id, name)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING
+`
+
+type CreatePostCategoryParams struct {
+	PostID uuid.UUID
+	Name   string
+}
+
+func (q *Queries) CreatePostCategory(ctx context.Context, arg CreatePostCategoryParams) error {
+	_, err := q.db.ExecContext(ctx, createPostCategory, arg.PostID, arg.Name)
+	return err
+}
+
+const createPostEnclosure = `-- name: CreatePostEnclosure :exec
+INSERT INTO post_enclosures (post_id, url, kind, mime_type, length, duration_seconds, episode)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (post_id, url) DO UPDATE
+SET kind = EXCLUDED.kind,
+mime_type = EXCLUDED.mime_type,
+length = EXCLUDED.length,
+duration_seconds = EXCLUDED.duration_seconds,
+episode = EXCLUDED.episode
+`
+
+type CreatePostEnclosureParams struct {
+	PostID          uuid.UUID
+	Url             string
+	Kind            string
+	MimeType        sql.NullString
+	Length          sql.NullInt64
+	DurationSeconds sql.NullInt32
+	Episode         sql.NullInt32
+}
+
+func (q *Queries) CreatePostEnclosure(ctx context.Context, arg CreatePostEnclosureParams) error {
+	_, err := q.db.ExecContext(ctx, createPostEnclosure,
+		arg.PostID,
+		arg.Url,
+		arg.Kind,
+		arg.MimeType,
+		arg.Length,
+		arg.DurationSeconds,
+		arg.Episode,
+	)
+	return err
+}
+
+const deleteAllPosts = `-- name: DeleteAllPosts :exec
+DELETE FROM posts
+`
+
+func (q *Queries) DeleteAllPosts(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, deleteAllPosts)
+	return err
+}
+
+const deleteStalePostCategories = `-- name: DeleteStalePostCategories :exec
+DELETE FROM post_categories
+WHERE post_id = $1 AND NOT (name = ANY($2::text[]))
+`
+
+type DeleteStalePostCategoriesParams struct {
+	PostID uuid.UUID
+	Names  []string
+}
+
+// Removes the categories of a post that are not in names.
+func (q *Queries) DeleteStalePostCategories(ctx context.Context, arg DeleteStalePostCategoriesParams) error {
+	_, err := q.db.ExecContext(ctx, deleteStalePostCategories, arg.PostID, pq.Array(arg.Names))
+	return err
+}
+
+const deleteStalePostEnclosures = `-- name: DeleteStalePostEnclosures :exec
+DELETE FROM post_enclosures
+WHERE post_id = $1 AND NOT (url = ANY($2::text[]))
 `
 
-type CreatePostParams struct {
+type DeleteStalePostEnclosuresParams struct {
+	PostID uuid.UUID
+	Urls   []string
+}
+
+// Removes the enclosures of a post whose URL is not in urls.
+func (q *Queries) DeleteStalePostEnclosures(ctx context.Context, arg DeleteStalePostEnclosuresParams) error {
+	_, err := q.db.ExecContext(ctx, deleteStalePostEnclosures, arg.PostID, pq.Array(arg.Urls))
+	return err
+}
+
+const getPostEnclosures = `-- name: GetPostEnclosures :many
+SELECT post_id, url, kind, mime_type, length, duration_seconds, episode FROM post_enclosures
+WHERE post_id = $1
+ORDER BY kind, url
+`
+
+func (q *Queries) GetPostEnclosures(ctx context.Context, postID uuid.UUID) ([]PostEnclosure, error) {
+	rows, err := q.db.QueryContext(ctx, getPostEnclosures, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []PostEnclosure
+	for rows.Next() {
+		var i PostEnclosure
+		if err := rows.Scan(
+			&i.PostID,
+			&i.Url,
+			&i.Kind,
+			&i.MimeType,
+			&i.Length,
+			&i.DurationSeconds,
+			&i.Episode,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPostIDByDedupKey = `-- name: GetPostIDByDedupKey :one
+SELECT id FROM posts
+WHERE feed_id = $1 AND dedup_key = $2
+`
+
+type GetPostIDByDedupKeyParams struct {
+	FeedID   uuid.UUID
+	DedupKey string
+}
+
+func (q *Queries) GetPostIDByDedupKey(ctx context.Context, arg GetPostIDByDedupKeyParams) (uuid.UUID, error) {
+	row := q.db.QueryRowContext(ctx, getPostIDByDedupKey, arg.FeedID, arg.DedupKey)
+	var id uuid.UUID
+	err := row.Scan(&id)
+	return id, err
+}
+
+const getStarredPosts = `-- name: GetStarredPosts :many
+SELECT user_id, post_id, saved_at, feed_name, title, url, description, content, author, published_at FROM saved_posts
+WHERE user_id = $1
+ORDER BY saved_at DESC
+`
+
+func (q *Queries) GetStarredPosts(ctx context.Context, userID uuid.UUID) ([]SavedPost, error) {
+	rows, err := q.db.QueryContext(ctx, getStarredPosts, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SavedPost
+	for rows.Next() {
+		var i SavedPost
+		if err := rows.Scan(
+			&i.UserID,
+			&i.PostID,
+			&i.SavedAt,
+			&i.FeedName,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.Content,
+			&i.Author,
+			&i.PublishedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const isPostFollowed = `-- name: IsPostFollowed :one
+SELECT EXISTS (
+  SELECT 1 FROM posts
+  JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+  WHERE posts.id = $1 AND feed_follows.user_id = $2
+)
+`
+
+type IsPostFollowedParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+// Reports whether a post belongs to a feed the user follows.
+func (q *Queries) IsPostFollowed(ctx context.Context, arg IsPostFollowedParams) (bool, error) {
+	row := q.db.QueryRowContext(ctx, isPostFollowed, arg.ID, arg.UserID)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const markPostRead = `-- name: MarkPostRead :exec
+INSERT INTO post_reads (user_id, post_id, read_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, post_id) DO NOTHING
+`
+
+type MarkPostReadParams struct {
+	UserID uuid.UUID
+	PostID uuid.UUID
+	ReadAt time.Time
+}
+
+func (q *Queries) MarkPostRead(ctx context.Context, arg MarkPostReadParams) error {
+	_, err := q.db.ExecContext(ctx, markPostRead, arg.UserID, arg.PostID, arg.ReadAt)
+	return err
+}
+
+const markPostUnread = `-- name: MarkPostUnread :execrows
+DELETE FROM post_reads
+WHERE user_id = $1 AND post_id = $2
+`
+
+type MarkPostUnreadParams struct {
+	UserID uuid.UUID
+	PostID uuid.UUID
+}
+
+func (q *Queries) MarkPostUnread(ctx context.Context, arg MarkPostUnreadParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markPostUnread, arg.UserID, arg.PostID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const markPostsRead = `-- name: MarkPostsRead :execrows
+INSERT INTO post_reads (user_id, post_id, read_at)
+SELECT feed_follows.user_id, posts.id, $1
+FROM posts
+JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+JOIN feeds ON posts.feed_id = feeds.id
+WHERE feed_follows.user_id = $2
+AND ($3::text IS NULL OR feeds.url = $3)
+AND ($4::timestamp IS NULL OR posts.published_at < $4)
+ON CONFLICT (user_id, post_id) DO NOTHING
+`
+
+type MarkPostsReadParams struct {
+	ReadAt  time.Time
+	UserID  uuid.UUID
+	FeedUrl sql.NullString
+	Before  sql.NullTime
+}
+
+// Marks the posts of the feeds a user follows as read, optionally only those
+// of one feed or published before a given time.
+func (q *Queries) MarkPostsRead(ctx context.Context, arg MarkPostsReadParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markPostsRead,
+		arg.ReadAt,
+		arg.UserID,
+		arg.FeedUrl,
+		arg.Before,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const searchPosts = `-- name: SearchPosts :many
+SELECT posts.id, posts.title, posts.url, posts.published_at, feeds.name AS feed_name,
+  ts_rank(posts.search_vector, websearch_to_tsquery('english', $1)) AS rank,
+  ts_headline('english', concat_ws(' ', posts.title, posts.description, posts.content), websearch_to_tsquery('english', $1), 'StartSel=**, StopSel=**, MaxFragments=2')::text AS headline
+FROM posts
+JOIN feeds ON posts.feed_id = feeds.id
+WHERE posts.search_vector @@ websearch_to_tsquery('english', $1)
+AND ($2::boolean OR EXISTS (
+  SELECT 1 FROM feed_follows
+  WHERE feed_follows.feed_id = posts.feed_id AND feed_follows.user_id = $3
+))
+ORDER BY rank DESC, posts.published_at DESC
+LIMIT $4
+`
+
+type SearchPostsParams struct {
+	Query    string
+	AllFeeds bool
+	UserID   uuid.UUID
+	Limit    int32
+}
+
+type SearchPostsRow struct {
 	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
 	Title       string
 	Url         string
-	Description sql.NullString
 	PublishedAt sql.NullTime
-	FeedID      uuid.UUID
+	FeedName    string
+	Rank        float32
+	Headline    string
+}
+
+// Full-text search over the posts of the feeds a user follows, or of every
+// feed when all_feeds is set. The query uses web search syntax: quoted
+// phrases, OR and -excluded words.
+func (q *Queries) SearchPosts(ctx context.Context, arg SearchPostsParams) ([]SearchPostsRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchPosts,
+		arg.Query,
+		arg.AllFeeds,
+		arg.UserID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchPostsRow
+	for rows.Next() {
+		var i SearchPostsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.Url,
+			&i.PublishedAt,
+			&i.FeedName,
+			&i.Rank,
+			&i.Headline,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const starPost = `-- name: StarPost :execrows
+INSERT INTO saved_posts (user_id, post_id, saved_at, feed_name, title, url, description, content, author, published_at)
+SELECT $1, posts.id, $3, feeds.name, posts.title, posts.url, posts.description, posts.content, posts.author, posts.published_at
+FROM posts
+JOIN feeds ON posts.feed_id = feeds.id
+WHERE posts.id = $2
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET feed_name = EXCLUDED.feed_name,
+title = EXCLUDED.title,
+url = EXCLUDED.url,
+description = EXCLUDED.description,
+content = EXCLUDED.content,
+author = EXCLUDED.author,
+published_at = EXCLUDED.published_at
+`
+
+type StarPostParams struct {
+	UserID  uuid.UUID
+	ID      uuid.UUID
+	SavedAt time.Time
+}
+
+// Saves a snapshot of a post for a user. Starring a post again refreshes the
+// snapshot. No row is affected when the post doesn't exist.
+func (q *Queries) StarPost(ctx context.Context, arg StarPostParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, starPost, arg.UserID, arg.ID, arg.SavedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const unstarPost = `-- name: UnstarPost :execrows
+DELETE FROM saved_posts
+WHERE user_id = $1 AND post_id = $2
+`
+
+type UnstarPostParams struct {
+	UserID uuid.UUID
+	PostID uuid.UUID
+}
+
+func (q *Queries) UnstarPost(ctx context.Context, arg UnstarPostParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, unstarPost, arg.UserID, arg.PostID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
-func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, error) {
-	row := q.db.QueryRowContext(ctx, createPost,
+const upsertPost = `-- name: UpsertPost :one
+INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id, published_at_estimated, guid, author, content, comments_url, dedup_key)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+ON CONFLICT (feed_id, dedup_key) DO UPDATE
+SET title = EXCLUDED.title,
+url = EXCLUDED.url,
+description = EXCLUDED.description,
+author = EXCLUDED.author,
+content = EXCLUDED.content,
+comments_url = EXCLUDED.comments_url,
+updated_at = EXCLUDED.updated_at
+WHERE posts.title IS DISTINCT FROM EXCLUDED.title
+OR posts.description IS DISTINCT FROM EXCLUDED.description
+OR posts.content IS DISTINCT FROM EXCLUDED.content
+OR posts.url IS DISTINCT FROM EXCLUDED.url
+OR posts.author IS DISTINCT FROM EXCLUDED.author
+OR posts.comments_url IS DISTINCT FROM EXCLUDED.comments_url
+RETURNING id, (xmax = 0)::boolean AS inserted
+`
+
+type UpsertPostParams struct {
+	ID                   uuid.UUID
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+	Title                string
+	Url                  string
+	Description          sql.NullString
+	PublishedAt          sql.NullTime
+	FeedID               uuid.UUID
+	PublishedAtEstimated bool
+	Guid                 sql.NullString
+	Author               sql.NullString
+	Content              sql.NullString
+	CommentsUrl          sql.NullString
+	DedupKey             string
+}
+
+type UpsertPostRow struct {
+	ID       uuid.UUID
+	Inserted bool
+}
+
+// Inserts a post, or updates the stored post with the same identity in its
+// feed when its title, URL, description, content, author or comments link
+// changed. No row is returned when the post is already stored unchanged.
+func (q *Queries) UpsertPost(ctx context.Context, arg UpsertPostParams) (UpsertPostRow, error) {
+	row := q.db.QueryRowContext(ctx, upsertPost,
 		arg.ID,
 		arg.CreatedAt,
 		arg.UpdatedAt,
@@ -40,26 +617,14 @@ func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, e
 		arg.Description,
 		arg.PublishedAt,
 		arg.FeedID,
+		arg.PublishedAtEstimated,
+		arg.Guid,
+		arg.Author,
+		arg.Content,
+		arg.CommentsUrl,
+		arg.DedupKey,
 	)
-	var i Post
-	err := row.Scan(
-		&i.ID,
-		&i.CreatedAt,
-		&i.UpdatedAt,
-		&i.Title,
-		&i.Url,
-		&i.Description,
-		&i.PublishedAt,
-		&i.FeedID,
-	)
+	var i UpsertPostRow
+	err := row.Scan(&i.ID, &i.Inserted)
 	return i, err
 }
-
-const deleteAllPosts = `-- name: DeleteAllPosts :exec
-DELETE FROM posts
-`
-
-func (q *Queries) DeleteAllPosts(ctx context.Context) error {
-	_, err := q.db.ExecContext(ctx, deleteAllPosts)
-	return err
-}
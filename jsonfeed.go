@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+)
+
+const jsonFeedVersionPrefix = "https://jsonfeed.org/version/1"
+
+type JSONFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url"`
+	Description string           `json:"description"`
+	Author      *JSONFeedAuthor  `json:"author"`
+	Authors     []JSONFeedAuthor `json:"authors"`
+	Items       []JSONFeedItem   `json:"items"`
+}
+
+type JSONFeedItem struct {
+	ID            json.RawMessage      `json:"id"`
+	URL           string               `json:"url"`
+	ExternalURL   string               `json:"external_url"`
+	Title         string               `json:"title"`
+	ContentHTML   string               `json:"content_html"`
+	ContentText   string               `json:"content_text"`
+	Summary       string               `json:"summary"`
+	DatePublished string               `json:"date_published"`
+	DateModified  string               `json:"date_modified"`
+	Author        *JSONFeedAuthor      `json:"author"`
+	Authors       []JSONFeedAuthor     `json:"authors"`
+	Tags          []string             `json:"tags"`
+	Attachments   []JSONFeedAttachment `json:"attachments"`
+}
+
+// JSONFeedAuthor is the author object of JSON Feed. Version 1.0 has a single
+// "author", version 1.1 an "authors" array.
+type JSONFeedAuthor struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+type JSONFeedAttachment struct {
+	URL               string  `json:"url"`
+	MimeType          string  `json:"mime_type"`
+	SizeInBytes       int64   `json:"size_in_bytes"`
+	DurationInSeconds float64 `json:"duration_in_seconds"`
+}
+
+// isJSONContentType reports whether a Content-Type header announces a JSON
+// document.
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/feed+json" || mediaType == "application/json"
+}
+
+// isJSONFeed sniffs a body for a JSON object carrying a JSON Feed version,
+// for servers that send JSON Feeds with a generic content type.
+func isJSONFeed(body []byte) bool {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return false
+	}
+	var probe struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(trimmed, &probe); err != nil {
+		return false
+	}
+	return strings.HasPrefix(probe.Version, jsonFeedVersionPrefix)
+}
+
+// jsonFeedID returns an item id as a string. The spec requires ids to be
+// strings, but some publishers emit numbers.
+func jsonFeedID(raw json.RawMessage) string {
+	var id string
+	if err := json.Unmarshal(raw, &id); err == nil {
+		return id
+	}
+	return strings.TrimSpace(string(raw))
+}
+
+func jsonFeedAuthors(author *JSONFeedAuthor, authors []JSONFeedAuthor) string {
+	if author != nil {
+		authors = append([]JSONFeedAuthor{*author}, authors...)
+	}
+	var names []string
+	for _, a := range authors {
+		if name := strings.TrimSpace(a.Name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+func parseJSONFeed(body []byte) (*ParsedFeed, error) {
+	var feed JSONFeed
+	if err := json.Unmarshal(body, &feed); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON Feed: %w", err)
+	}
+	if !strings.HasPrefix(feed.Version, jsonFeedVersionPrefix) {
+		return nil, fmt.Errorf("unsupported JSON Feed version: %q", feed.Version)
+	}
+
+	parsed := &ParsedFeed{
+		Title:       feed.Title,
+		Link:        feed.HomePageURL,
+		Description: feed.Description,
+		Items:       make([]FeedItem, 0, len(feed.Items)),
+	}
+	for _, item := range feed.Items {
+		link := item.URL
+		if link == "" {
+			link = item.ExternalURL
+		}
+		content := item.ContentHTML
+		if content == "" {
+			content = item.ContentText
+		}
+		description := item.Summary
+		if description == "" {
+			description = content
+		}
+		pubDate := item.DatePublished
+		if pubDate == "" {
+			pubDate = item.DateModified
+		}
+
+		author := jsonFeedAuthors(item.Author, item.Authors)
+		if author == "" {
+			author = jsonFeedAuthors(feed.Author, feed.Authors)
+		}
+
+		parsedItem := FeedItem{
+			GUID:        jsonFeedID(item.ID),
+			Title:       item.Title,
+			Link:        link,
+			Description: description,
+			Content:     content,
+			Author:      author,
+			PubDate:     pubDate,
+			Categories:  item.Tags,
+		}
+		for _, attachment := range item.Attachments {
+			parsedItem.Enclosures = append(parsedItem.Enclosures, FeedEnclosure{
+				URL:      attachment.URL,
+				Type:     attachment.MimeType,
+				Length:   max(attachment.SizeInBytes, 0),
+				Kind:     enclosureKind(attachment.MimeType, ""),
+				Duration: time.Duration(max(attachment.DurationInSeconds, 0) * float64(time.Second)).Round(time.Second),
+			})
+		}
+		parsed.Items = append(parsed.Items, parsedItem)
+	}
+	return parsed, nil
+}
@@ -15,6 +15,8 @@ import (
 type state struct {
     Config *config.Config   
     DBQueries *database.Queries
+    HTTPClient *feedClient
+    Output outputFormat
 }
 
 type command struct {
@@ -39,8 +41,18 @@ func main()  {
     defer db.Close()
 
     dbQueries := database.New(db)
+
+    httpClient, err := newFeedClient(cfg.HTTP)
+    if err != nil {
+        log.Fatalf("Error configuring HTTP client: %v", err)
+    }
     
-    s := &state{Config: cfg, DBQueries: dbQueries}
+    args, output, err := extractOutputFlag(os.Args[1:])
+    if err != nil {
+        log.Fatalf("Error parsing options: %v", err)
+    }
+
+    s := &state{Config: cfg, DBQueries: dbQueries, HTTPClient: httpClient, Output: output}
    
     cmds := &commands{}
     cmds.register("login", handlerLogin)    
@@ -49,20 +61,31 @@ func main()  {
     cmds.register("users", handlerUsers)    
     cmds.register("agg", handlerAgg)
     cmds.register("addfeed", middlewareLoggedIn(handlerAddFeed))
+    cmds.register("editfeed", middlewareLoggedIn(handlerEditFeed))
     cmds.register("feeds", handlerFeeds)
+    cmds.register("unhealthy", handlerUnhealthy)
     cmds.register("follow", middlewareLoggedIn(handlerFollow))
     cmds.register("following", middlewareLoggedIn(handlerFollowing))
     cmds.register("unfollow", middlewareLoggedIn(handlerUnfollow))
     cmds.register("browse", middlewareLoggedIn(handlerBrowse))
+    cmds.register("read", middlewareLoggedIn(handlerRead))
+    cmds.register("unread", middlewareLoggedIn(handlerUnread))
+    cmds.register("markall-read", middlewareLoggedIn(handlerMarkAllRead))
+    cmds.register("star", middlewareLoggedIn(handlerStar))
+    cmds.register("unstar", middlewareLoggedIn(handlerUnstar))
+    cmds.register("starred", middlewareLoggedIn(handlerStarred))
+    cmds.register("search", middlewareLoggedIn(handlerSearch))
+    cmds.register("import", middlewareLoggedIn(handlerImport))
+    cmds.register("export", middlewareLoggedIn(handlerExport))
 
-    if len(os.Args) < 2 {
+    if len(args) < 1 {
         fmt.Println("Error: No command provided")
         os.Exit(1)
     }
 
     cmd := command{
-        Name: os.Args[1],
-        Args: os.Args[2:],
+        Name: args[0],
+        Args: args[1:],
     }
 
     err = cmds.run(s, cmd)
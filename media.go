@@ -0,0 +1,167 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kinds of FeedEnclosure. Media files are what podcasts and video feeds
+// publish, images and thumbnails illustrate the item.
+const (
+	enclosureMedia     = "media"
+	enclosureImage     = "image"
+	enclosureThumbnail = "thumbnail"
+)
+
+type RSSEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length string `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// MediaContent is a <media:content> element of the Media RSS module.
+type MediaContent struct {
+	URL       string           `xml:"url,attr"`
+	Type      string           `xml:"type,attr"`
+	Medium    string           `xml:"medium,attr"`
+	FileSize  string           `xml:"fileSize,attr"`
+	Duration  string           `xml:"duration,attr"`
+	Thumbnail []MediaThumbnail `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+}
+
+// MediaGroup bundles alternative <media:content> renditions of one item.
+type MediaGroup struct {
+	Content   []MediaContent   `xml:"http://search.yahoo.com/mrss/ content"`
+	Thumbnail []MediaThumbnail `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+}
+
+type MediaThumbnail struct {
+	URL string `xml:"url,attr"`
+}
+
+type ITunesImage struct {
+	Href string `xml:"href,attr"`
+}
+
+// rssEnclosures collects the enclosures, Media RSS content and thumbnails and
+// iTunes image of an RSS item. The iTunes duration and episode number apply
+// to the item's media files.
+func rssEnclosures(item RSSItem) []FeedEnclosure {
+	var enclosures []FeedEnclosure
+	for _, enclosure := range item.Enclosure {
+		length, _ := strconv.ParseInt(strings.TrimSpace(enclosure.Length), 10, 64)
+		enclosures = append(enclosures, FeedEnclosure{
+			URL:    enclosure.URL,
+			Type:   enclosure.Type,
+			Length: max(length, 0),
+			Kind:   enclosureKind(enclosure.Type, ""),
+		})
+	}
+
+	contents := item.MediaContent
+	thumbnails := item.MediaThumbnail
+	for _, group := range item.MediaGroup {
+		contents = append(contents, group.Content...)
+		thumbnails = append(thumbnails, group.Thumbnail...)
+	}
+	for _, content := range contents {
+		length, _ := strconv.ParseInt(strings.TrimSpace(content.FileSize), 10, 64)
+		enclosures = append(enclosures, FeedEnclosure{
+			URL:      content.URL,
+			Type:     content.Type,
+			Length:   max(length, 0),
+			Kind:     enclosureKind(content.Type, content.Medium),
+			Duration: parseMediaDuration(content.Duration),
+		})
+		thumbnails = append(thumbnails, content.Thumbnail...)
+	}
+	for _, thumbnail := range thumbnails {
+		enclosures = append(enclosures, FeedEnclosure{URL: thumbnail.URL, Kind: enclosureThumbnail})
+	}
+	if item.ITunesImage.Href != "" {
+		enclosures = append(enclosures, FeedEnclosure{URL: item.ITunesImage.Href, Kind: enclosureImage})
+	}
+
+	duration := parseMediaDuration(item.ITunesDuration)
+	episode, _ := strconv.Atoi(strings.TrimSpace(item.ITunesEpisode))
+	for i := range enclosures {
+		if enclosures[i].Kind != enclosureMedia {
+			continue
+		}
+		if enclosures[i].Duration == 0 {
+			enclosures[i].Duration = duration
+		}
+		enclosures[i].Episode = max(episode, 0)
+	}
+	return enclosures
+}
+
+// enclosureKind classifies an enclosure by its MIME type or Media RSS medium.
+func enclosureKind(mimeType, medium string) string {
+	if medium == "image" || strings.HasPrefix(strings.ToLower(mimeType), "image/") {
+		return enclosureImage
+	}
+	return enclosureMedia
+}
+
+// parseMediaDuration parses an iTunes or Media RSS duration, which is either
+// a number of seconds or a [[HH:]MM:]SS clock value.
+func parseMediaDuration(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	parts := strings.Split(value, ":")
+	if len(parts) > 3 {
+		return 0
+	}
+	var seconds float64
+	for i, part := range parts {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil || n < 0 {
+			return 0
+		}
+		// Only the seconds field may be fractional.
+		if i < len(parts)-1 && n != float64(int(n)) {
+			return 0
+		}
+		seconds = seconds*60 + n
+	}
+	return time.Duration(seconds * float64(time.Second)).Round(time.Second)
+}
+
+// cleanEnclosures trims enclosure URLs, dropping empty ones and merging
+// duplicates, which feeds commonly publish both as <enclosure> and as
+// <media:content>.
+func cleanEnclosures(enclosures []FeedEnclosure) []FeedEnclosure {
+	var cleaned []FeedEnclosure
+	index := make(map[string]int)
+	for _, enclosure := range enclosures {
+		enclosure.URL = strings.TrimSpace(enclosure.URL)
+		enclosure.Type = strings.TrimSpace(enclosure.Type)
+		if enclosure.URL == "" {
+			continue
+		}
+		i, seen := index[enclosure.URL]
+		if !seen {
+			index[enclosure.URL] = len(cleaned)
+			cleaned = append(cleaned, enclosure)
+			continue
+		}
+		existing := &cleaned[i]
+		if existing.Type == "" {
+			existing.Type = enclosure.Type
+		}
+		if existing.Length == 0 {
+			existing.Length = enclosure.Length
+		}
+		if existing.Duration == 0 {
+			existing.Duration = enclosure.Duration
+		}
+		if existing.Episode == 0 {
+			existing.Episode = enclosure.Episode
+		}
+	}
+	return cleaned
+}
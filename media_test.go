@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseMediaDuration(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  time.Duration
+	}{
+		{"seconds", "2712", 2712 * time.Second},
+		{"minutes and seconds", "45:12", 45*time.Minute + 12*time.Second},
+		{"hours", "1:02:03", time.Hour + 2*time.Minute + 3*time.Second},
+		{"fractional seconds", "90.6", 91 * time.Second},
+		{"whitespace", " 01:00 ", time.Minute},
+		{"minutes over 59", "75:00", 75 * time.Minute},
+		{"empty", "", 0},
+		{"text", "long", 0},
+		{"too many fields", "1:02:03:04", 0},
+		{"fractional minutes", "1.5:00", 0},
+		{"negative", "-30", 0},
+		{"empty field", "1::03", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseMediaDuration(tt.input); got != tt.want {
+				t.Errorf("parseMediaDuration(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type OPML struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    struct {
+		Title       string `xml:"title,omitempty"`
+		DateCreated string `xml:"dateCreated,omitempty"`
+		OwnerName   string `xml:"ownerName,omitempty"`
+	} `xml:"head"`
+	Body struct {
+		Outlines []OPMLOutline `xml:"outline"`
+	} `xml:"body"`
+}
+
+type OPMLOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr,omitempty"`
+	Type     string        `xml:"type,attr,omitempty"`
+	XMLURL   string        `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string        `xml:"htmlUrl,attr,omitempty"`
+	Outlines []OPMLOutline `xml:"outline"`
+}
+
+// opmlSubscription is a feed outline found in an OPML document. Folder is
+// the path of the enclosing folder outlines, see joinFolderPath.
+type opmlSubscription struct {
+	Name    string
+	XMLURL  string
+	HTMLURL string
+	Folder  string
+}
+
+// opmlInvalidEntry is an outline that could not be turned into a
+// subscription, with the reason why.
+type opmlInvalidEntry struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// newOPML builds an OPML 2.0 document of subscriptions, nesting each one in
+// outlines for the folders of its path.
+func newOPML(title, owner string, created time.Time, subs []opmlSubscription) *OPML {
+	doc := &OPML{Version: "2.0"}
+	doc.Head.Title = title
+	doc.Head.OwnerName = owner
+	doc.Head.DateCreated = created.Format(time.RFC1123Z)
+
+	for _, sub := range subs {
+		outlines := &doc.Body.Outlines
+		if sub.Folder != "" {
+			for _, folder := range splitFolderPath(sub.Folder) {
+				outlines = folderOutlines(outlines, folder)
+			}
+		}
+		*outlines = append(*outlines, OPMLOutline{
+			Text:    sub.Name,
+			Title:   sub.Name,
+			Type:    "rss",
+			XMLURL:  sub.XMLURL,
+			HTMLURL: sub.HTMLURL,
+		})
+	}
+	return doc
+}
+
+// folderOutlines returns the children of the folder outline called name,
+// appending the folder to outlines first if it doesn't exist yet.
+func folderOutlines(outlines *[]OPMLOutline, name string) *[]OPMLOutline {
+	for i := range *outlines {
+		if (*outlines)[i].XMLURL == "" && (*outlines)[i].Text == name {
+			return &(*outlines)[i].Outlines
+		}
+	}
+	*outlines = append(*outlines, OPMLOutline{Text: name, Title: name})
+	return &(*outlines)[len(*outlines)-1].Outlines
+}
+
+func (doc *OPML) marshal() ([]byte, error) {
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal OPML: %v", err)
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
+
+func parseOPML(data []byte) (*OPML, error) {
+	var doc OPML
+	if err := newXMLDecoder(toUTF8(data, "")).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal OPML: %v", err)
+	}
+	return &doc, nil
+}
+
+// subscriptions flattens the outline tree of an OPML document. Outlines with
+// an xmlUrl are subscriptions, outlines with children are folders, and
+// anything else is reported as invalid.
+func (doc *OPML) subscriptions() ([]opmlSubscription, []opmlInvalidEntry) {
+	var subs []opmlSubscription
+	var invalid []opmlInvalidEntry
+
+	var walk func(outlines []OPMLOutline, folder string)
+	walk = func(outlines []OPMLOutline, folder string) {
+		for _, outline := range outlines {
+			name := strings.TrimSpace(outline.Text)
+			if name == "" {
+				name = strings.TrimSpace(outline.Title)
+			}
+			feedURL := strings.TrimSpace(outline.XMLURL)
+
+			switch {
+			case feedURL != "":
+				if err := validateFeedURL(feedURL); err != nil {
+					invalid = append(invalid, opmlInvalidEntry{Name: name, Reason: err.Error()})
+					continue
+				}
+				if name == "" {
+					name = feedURL
+				}
+				subs = append(subs, opmlSubscription{
+					Name:    name,
+					XMLURL:  feedURL,
+					HTMLURL: strings.TrimSpace(outline.HTMLURL),
+					Folder:  folder,
+				})
+			case len(outline.Outlines) > 0:
+				walk(outline.Outlines, joinFolderPath(folder, name))
+			default:
+				invalid = append(invalid, opmlInvalidEntry{Name: name, Reason: "outline has no xmlUrl"})
+			}
+		}
+	}
+	walk(doc.Body.Outlines, "")
+
+	return subs, invalid
+}
+
+// joinFolderPath appends a folder name to a folder path. Folders are separated
+// by "/", and a "/" or "\" within a name is escaped with a backslash.
+func joinFolderPath(path, name string) string {
+	name = strings.NewReplacer(`\`, `\\`, "/", `\/`).Replace(name)
+	if path == "" {
+		return name
+	}
+	return path + "/" + name
+}
+
+// splitFolderPath is the inverse of joinFolderPath.
+func splitFolderPath(path string) []string {
+	var names []string
+	var name strings.Builder
+	for i := 0; i < len(path); i++ {
+		switch {
+		case path[i] == '\\' && i+1 < len(path):
+			i++
+			name.WriteByte(path[i])
+		case path[i] == '/':
+			names = append(names, name.String())
+			name.Reset()
+		default:
+			name.WriteByte(path[i])
+		}
+	}
+	return append(names, name.String())
+}
+
+// validateFeedURL checks that a feed URL is an absolute http(s) URL.
+func validateFeedURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL %q: %v", rawURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid URL %q: scheme must be http or https", rawURL)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid URL %q: missing host", rawURL)
+	}
+	return nil
+}
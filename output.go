@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// outputFormat selects how commands print their results. Text is meant for
+// people; the other formats print the records of a command with the field
+// names of their json tags, which are kept stable for scripts.
+type outputFormat string
+
+const (
+	outputText  outputFormat = "text"
+	outputJSON  outputFormat = "json"
+	outputJSONL outputFormat = "jsonl"
+	outputCSV   outputFormat = "csv"
+	outputTSV   outputFormat = "tsv"
+)
+
+// extractOutputFlag removes the global --output option, given as
+// "--output <format>" or "--output=<format>" before the command name, from
+// the command line. Everything from the command name on is left to the
+// command, as is everything after "--".
+func extractOutputFlag(args []string) ([]string, outputFormat, error) {
+	value := string(outputText)
+	for len(args) > 0 {
+		switch {
+		case args[0] == "--output":
+			if len(args) < 2 {
+				return nil, "", fmt.Errorf("--output needs a value")
+			}
+			value = args[1]
+			args = args[2:]
+			continue
+		case strings.HasPrefix(args[0], "--output="):
+			value = strings.TrimPrefix(args[0], "--output=")
+			args = args[1:]
+			continue
+		case args[0] == "--":
+			args = args[1:]
+		}
+		break
+	}
+
+	switch format := outputFormat(strings.ToLower(value)); format {
+	case outputText, outputJSON, outputJSONL, outputCSV, outputTSV:
+		return args, format, nil
+	default:
+		return nil, "", fmt.Errorf("invalid output format %q, use text, json, jsonl, csv or tsv", value)
+	}
+}
+
+// render prints a listing. records is a slice of structs; text prints it for
+// the text format.
+func (s *state) render(records any, text func()) error {
+	if s.Output == outputText {
+		text()
+		return nil
+	}
+	return writeRecords(os.Stdout, s.Output, reflect.ValueOf(records), false)
+}
+
+// renderOne prints the single record a command produced. In JSON it is
+// printed as an object rather than an array.
+func (s *state) renderOne(record any, text func()) error {
+	if s.Output == outputText {
+		text()
+		return nil
+	}
+	value := reflect.ValueOf(record)
+	list := reflect.MakeSlice(reflect.SliceOf(value.Type()), 0, 1)
+	return writeRecords(os.Stdout, s.Output, reflect.Append(list, value), true)
+}
+
+// notice prints a message that isn't part of a command's records. Outside
+// the text format it goes to stderr so it doesn't corrupt the output.
+func (s *state) notice(format string, args ...any) {
+	w := io.Writer(os.Stdout)
+	if s.Output != outputText {
+		w = os.Stderr
+	}
+	fmt.Fprintf(w, format, args...)
+}
+
+func writeRecords(w io.Writer, format outputFormat, records reflect.Value, single bool) error {
+	switch format {
+	case outputJSON:
+		var data []byte
+		var err error
+		switch {
+		case single:
+			data, err = json.MarshalIndent(records.Index(0).Interface(), "", "  ")
+		case records.Len() == 0:
+			data = []byte("[]")
+		default:
+			data, err = json.MarshalIndent(records.Interface(), "", "  ")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to encode JSON output: %v", err)
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	case outputJSONL:
+		encoder := json.NewEncoder(w)
+		for i := 0; i < records.Len(); i++ {
+			if err := encoder.Encode(records.Index(i).Interface()); err != nil {
+				return fmt.Errorf("failed to encode JSON output: %v", err)
+			}
+		}
+		return nil
+	default:
+		return writeTable(w, format, records)
+	}
+}
+
+// writeTable prints records as CSV or TSV with a header row. Nested values
+// such as lists are written as JSON, null values as empty cells. In TSV,
+// tabs, newlines and backslashes inside values are escaped as \t, \n and \\.
+func writeTable(w io.Writer, format outputFormat, records reflect.Value) error {
+	fields := recordFields(records.Type().Elem())
+	rows := make([][]string, 0, records.Len()+1)
+	header := make([]string, 0, len(fields))
+	for _, field := range fields {
+		header = append(header, field.name)
+	}
+	rows = append(rows, header)
+	for i := 0; i < records.Len(); i++ {
+		record := records.Index(i)
+		row := make([]string, 0, len(fields))
+		for _, field := range fields {
+			cell, err := formatCell(record.Field(field.index))
+			if err != nil {
+				return err
+			}
+			row = append(row, cell)
+		}
+		rows = append(rows, row)
+	}
+
+	if format == outputCSV {
+		writer := csv.NewWriter(w)
+		if err := writer.WriteAll(rows); err != nil {
+			return fmt.Errorf("failed to write CSV output: %v", err)
+		}
+		return nil
+	}
+	escaper := strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+	for _, row := range rows {
+		for i, cell := range row {
+			row[i] = escaper.Replace(cell)
+		}
+		if _, err := fmt.Fprintln(w, strings.Join(row, "\t")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type recordField struct {
+	name  string
+	index int
+}
+
+// recordFields lists the exported fields of a record type under the names of
+// their json tags.
+func recordFields(t reflect.Type) []recordField {
+	var fields []recordField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, recordField{name: name, index: i})
+	}
+	return fields
+}
+
+func formatCell(value reflect.Value) (string, error) {
+	switch value.Kind() {
+	case reflect.Slice, reflect.Map:
+		if value.IsNil() {
+			return "", nil
+		}
+	case reflect.Pointer:
+		if value.IsNil() {
+			return "", nil
+		}
+		value = value.Elem()
+	}
+	if t, ok := value.Interface().(time.Time); ok {
+		return t.UTC().Format(time.RFC3339), nil
+	}
+	if stringer, ok := value.Interface().(fmt.Stringer); ok {
+		return stringer.String(), nil
+	}
+	switch value.Kind() {
+	case reflect.String:
+		return value.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(value.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(value.Int(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(value.Float(), 'f', -1, value.Type().Bits()), nil
+	}
+	data, err := json.Marshal(value.Interface())
+	if err != nil {
+		return "", fmt.Errorf("failed to encode value: %v", err)
+	}
+	return string(data), nil
+}
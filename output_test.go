@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type tableRecord struct {
+	Name      string     `json:"name"`
+	Count     int        `json:"count"`
+	Ratio     float64    `json:"ratio"`
+	Active    bool       `json:"active"`
+	FetchedAt *time.Time `json:"fetched_at"`
+	Tags      []string   `json:"tags"`
+	Internal  string     `json:"-"`
+}
+
+func TestWriteTable(t *testing.T) {
+	fetched := time.Date(2024, 5, 6, 9, 8, 9, 0, time.FixedZone("CEST", 2*60*60))
+	tests := []struct {
+		name    string
+		format  outputFormat
+		records []tableRecord
+		want    string
+	}{
+		{"CSV header only", outputCSV, nil, "name,count,ratio,active,fetched_at,tags\n"},
+		{"TSV header only", outputTSV, nil, "name\tcount\tratio\tactive\tfetched_at\ttags\n"},
+		{
+			"CSV values", outputCSV,
+			[]tableRecord{{Name: "Go Blog", Count: 3, Ratio: 0.5, Active: true, FetchedAt: &fetched, Tags: []string{"go"}, Internal: "x"}},
+			"name,count,ratio,active,fetched_at,tags\nGo Blog,3,0.5,true,2024-05-06T07:08:09Z,\"[\"\"go\"\"]\"\n",
+		},
+		{
+			"CSV null values", outputCSV,
+			[]tableRecord{{Name: "Empty"}},
+			"name,count,ratio,active,fetched_at,tags\nEmpty,0,0,false,,\n",
+		},
+		{
+			"CSV quoting", outputCSV,
+			[]tableRecord{{Name: "Tea, \"Coffee\"\nand more"}},
+			"name,count,ratio,active,fetched_at,tags\n\"Tea, \"\"Coffee\"\"\nand more\",0,0,false,,\n",
+		},
+		{
+			"CSV empty list", outputCSV,
+			[]tableRecord{{Name: "Empty", Tags: []string{}}},
+			"name,count,ratio,active,fetched_at,tags\nEmpty,0,0,false,,[]\n",
+		},
+		{
+			"TSV escaping", outputTSV,
+			[]tableRecord{{Name: "a\tb\nc\\d", Tags: []string{"x", "y"}}},
+			"name\tcount\tratio\tactive\tfetched_at\ttags\na\\tb\\nc\\\\d\t0\t0\tfalse\t\t[\"x\",\"y\"]\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeTable(&buf, tt.format, reflect.ValueOf(tt.records)); err != nil {
+				t.Fatalf("writeTable() error = %v", err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("writeTable() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
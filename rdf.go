@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+// RDFFeed is an RSS 1.0 document. Unlike RSS 2.0, its items are siblings of
+// the channel element rather than children of it.
+type RDFFeed struct {
+	Channel struct {
+		Title           string `xml:"title"`
+		Link            string `xml:"link"`
+		Description     string `xml:"description"`
+		UpdatePeriod    string `xml:"http://purl.org/rss/1.0/modules/syndication/ updatePeriod"`
+		UpdateFrequency string `xml:"http://purl.org/rss/1.0/modules/syndication/ updateFrequency"`
+	} `xml:"channel"`
+	Item []RDFItem `xml:"item"`
+}
+
+type RDFItem struct {
+	About          string   `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# about,attr"`
+	Title          string   `xml:"title"`
+	Link           string   `xml:"link"`
+	Description    string   `xml:"description"`
+	ContentEncoded string   `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	Date           string   `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Creator        string   `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Subject        []string `xml:"http://purl.org/dc/elements/1.1/ subject"`
+}
+
+func parseRDF(decoder *xml.Decoder) (*ParsedFeed, error) {
+	var feed RDFFeed
+	if err := decoder.Decode(&feed); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal RDF XML: %w", err)
+	}
+
+	parsed := &ParsedFeed{
+		Title:       feed.Channel.Title,
+		Link:        feed.Channel.Link,
+		Description: feed.Channel.Description,
+		TTL:         syndicationInterval("", feed.Channel.UpdatePeriod, feed.Channel.UpdateFrequency),
+		Items:       make([]FeedItem, 0, len(feed.Item)),
+	}
+	for _, item := range feed.Item {
+		parsed.Items = append(parsed.Items, FeedItem{
+			GUID:        item.About,
+			Title:       item.Title,
+			Link:        item.Link,
+			Description: item.Description,
+			Content:     item.ContentEncoded,
+			Author:      item.Creator,
+			PubDate:     item.Date,
+			Categories:  item.Subject,
+		})
+	}
+	return parsed, nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/KrishKoria/Gator/internal/database"
+)
+
+// The record types below are the schemas of the structured output formats.
+// Their json tags are the field names in JSON and the column headers in CSV
+// and TSV. Missing values are null in JSON and empty cells in CSV and TSV,
+// and times are in UTC.
+
+// userRecord is printed by register and users.
+type userRecord struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	Current   bool      `json:"current"`
+}
+
+// feedRecord is printed by addfeed and feeds.
+type feedRecord struct {
+	ID                   uuid.UUID  `json:"id"`
+	Name                 string     `json:"name"`
+	URL                  string     `json:"url"`
+	SiteURL              *string    `json:"site_url"`
+	CreatedBy            string     `json:"created_by"`
+	CreatedAt            time.Time  `json:"created_at"`
+	FetchIntervalSeconds *int32     `json:"fetch_interval_seconds"`
+	LastFetchedAt        *time.Time `json:"last_fetched_at"`
+}
+
+// followRecord is printed by follow and following.
+type followRecord struct {
+	FeedID     uuid.UUID `json:"feed_id"`
+	FeedName   string    `json:"feed_name"`
+	FeedURL    string    `json:"feed_url"`
+	SiteURL    *string   `json:"site_url"`
+	Folder     *string   `json:"folder"`
+	UserName   string    `json:"user_name"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+// unhealthyFeedRecord is printed by unhealthy.
+type unhealthyFeedRecord struct {
+	ID                  uuid.UUID  `json:"id"`
+	Name                string     `json:"name"`
+	URL                 string     `json:"url"`
+	ConsecutiveFailures int32      `json:"consecutive_failures"`
+	LastError           *string    `json:"last_error"`
+	LastSuccessAt       *time.Time `json:"last_success_at"`
+	NextFetchAt         *time.Time `json:"next_fetch_at"`
+	ParseWarning        *string    `json:"parse_warning"`
+}
+
+// postRecord is printed by browse.
+type postRecord struct {
+	ID                   uuid.UUID         `json:"id"`
+	Title                string            `json:"title"`
+	URL                  string            `json:"url"`
+	FeedName             string            `json:"feed_name"`
+	Author               *string           `json:"author"`
+	Description          *string           `json:"description"`
+	PublishedAt          *time.Time        `json:"published_at"`
+	PublishedAtEstimated bool              `json:"published_at_estimated"`
+	ReadAt               *time.Time        `json:"read_at"`
+	Enclosures           []enclosureRecord `json:"enclosures"`
+}
+
+type enclosureRecord struct {
+	URL             string  `json:"url"`
+	Kind            string  `json:"kind"`
+	MimeType        *string `json:"mime_type"`
+	Length          *int64  `json:"length"`
+	DurationSeconds *int32  `json:"duration_seconds"`
+	Episode         *int32  `json:"episode"`
+}
+
+// starredPostRecord is printed by starred.
+type starredPostRecord struct {
+	PostID      uuid.UUID  `json:"post_id"`
+	Title       string     `json:"title"`
+	URL         string     `json:"url"`
+	FeedName    string     `json:"feed_name"`
+	Author      *string    `json:"author"`
+	Description *string    `json:"description"`
+	PublishedAt *time.Time `json:"published_at"`
+	StarredAt   time.Time  `json:"starred_at"`
+}
+
+// searchResultRecord is printed by search.
+type searchResultRecord struct {
+	ID          uuid.UUID  `json:"id"`
+	Title       string     `json:"title"`
+	URL         string     `json:"url"`
+	FeedName    string     `json:"feed_name"`
+	PublishedAt *time.Time `json:"published_at"`
+	Rank        float32    `json:"rank"`
+	Headline    string     `json:"headline"`
+}
+
+// importRecord is the report printed by import.
+type importRecord struct {
+	File            string             `json:"file"`
+	FeedsCreated    int                `json:"feeds_created"`
+	FeedsFollowed   int                `json:"feeds_followed"`
+	AlreadyFollowed int                `json:"already_followed"`
+	Duplicates      int                `json:"duplicates"`
+	Invalid         []opmlInvalidEntry `json:"invalid"`
+}
+
+func newFeedRecord(feed database.Feed, createdBy string) feedRecord {
+	return feedRecord{
+		ID:                   feed.ID,
+		Name:                 feed.Name,
+		URL:                  feed.Url,
+		SiteURL:              nullableString(feed.SiteUrl),
+		CreatedBy:            createdBy,
+		CreatedAt:            feed.CreatedAt.UTC(),
+		FetchIntervalSeconds: nullableInt32(feed.FetchIntervalSeconds),
+		LastFetchedAt:        nullableTime(feed.LastFetchedAt),
+	}
+}
+
+func newEnclosureRecord(enclosure database.PostEnclosure) enclosureRecord {
+	record := enclosureRecord{
+		URL:             enclosure.Url,
+		Kind:            enclosure.Kind,
+		MimeType:        nullableString(enclosure.MimeType),
+		DurationSeconds: nullableInt32(enclosure.DurationSeconds),
+		Episode:         nullableInt32(enclosure.Episode),
+	}
+	if enclosure.Length.Valid {
+		record.Length = &enclosure.Length.Int64
+	}
+	return record
+}
+
+func nullableString(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
+
+func nullableInt32(n sql.NullInt32) *int32 {
+	if !n.Valid {
+		return nil
+	}
+	return &n.Int32
+}
+
+func nullableTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	utc := t.Time.UTC()
+	return &utc
+}
@@ -0,0 +1,509 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/KrishKoria/Gator/internal/database"
+)
+
+// feedFetchTimeout bounds how long a single feed may take to be fetched and
+// stored before its context is cancelled.
+const feedFetchTimeout = 30 * time.Second
+
+// feedLeaseDuration is how long a claimed feed stays reserved for this
+// instance. It comfortably exceeds the time a feed can wait in the queue plus
+// feedFetchTimeout, so a lease only lapses if its instance has died.
+const feedLeaseDuration = 5 * time.Minute
+
+const (
+	failureBackoffBase = time.Minute
+	failureBackoffMax  = 24 * time.Hour
+)
+
+// maxHintInterval caps how far a publisher's TTL or cache hints can push back
+// the next fetch of a feed. Intervals set explicitly by users are not capped.
+const maxHintInterval = 24 * time.Hour
+
+// feedScraper fetches feeds with a bounded pool of workers. Feeds are leased
+// in the database under owner, so several aggregator instances can share one
+// database without fetching the same feed. Within the process it also keeps
+// track of the feeds currently being scraped so that a slow feed is never
+// handed to a second worker while the first fetch is still running.
+type feedScraper struct {
+	db          *database.Queries
+	client      *feedClient
+	owner       string
+	concurrency int
+	timeout     time.Duration
+	jobs        chan database.Feed
+
+	mu       sync.Mutex
+	inFlight map[uuid.UUID]bool
+}
+
+func newFeedScraper(db *database.Queries, client *feedClient, concurrency int, timeout time.Duration) *feedScraper {
+	return &feedScraper{
+		db:          db,
+		client:      client,
+		owner:       newLeaseOwner(),
+		concurrency: concurrency,
+		timeout:     timeout,
+		jobs:        make(chan database.Feed, concurrency),
+		inFlight:    make(map[uuid.UUID]bool),
+	}
+}
+
+// start launches the worker goroutines. They run until ctx is cancelled.
+func (fs *feedScraper) start(ctx context.Context) {
+	for i := 0; i < fs.concurrency; i++ {
+		go fs.worker(ctx)
+	}
+}
+
+func (fs *feedScraper) worker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case feed := <-fs.jobs:
+			feedCtx, cancel := context.WithTimeout(ctx, fs.timeout)
+			scrapeFeed(feedCtx, fs.db, fs.client, feed)
+			cancel()
+			fs.release(ctx, feed.ID)
+		}
+	}
+}
+
+// scrapeBatch claims the stalest unleased feeds and queues them for the
+// workers. Feeds that are still in flight are skipped, as are feeds that don't
+// fit in the queue because every worker is busy; their lease is given back so
+// they are picked up on a later tick.
+func (fs *feedScraper) scrapeBatch(ctx context.Context) {
+	feeds, err := fs.db.ClaimFeedsToFetch(ctx, database.ClaimFeedsToFetchParams{
+		LeaseOwner:   fs.owner,
+		LeaseSeconds: int32(feedLeaseDuration / time.Second),
+		BatchSize:    int32(fs.concurrency),
+	})
+	if err != nil {
+		log.Println("Couldn't claim feeds to fetch", err)
+		return
+	}
+
+	queued := 0
+	for _, feed := range feeds {
+		if !fs.claim(feed.ID) {
+			continue
+		}
+		select {
+		case fs.jobs <- feed:
+			queued++
+		default:
+			fs.release(ctx, feed.ID)
+		}
+	}
+	log.Printf("Queued %d of %d feeds to fetch", queued, len(feeds))
+}
+
+func (fs *feedScraper) claim(id uuid.UUID) bool {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.inFlight[id] {
+		return false
+	}
+	fs.inFlight[id] = true
+	return true
+}
+
+// release gives a feed back, both in the process and in the database.
+func (fs *feedScraper) release(ctx context.Context, id uuid.UUID) {
+	err := fs.db.ReleaseFeedLease(ctx, database.ReleaseFeedLeaseParams{
+		ID:         id,
+		LeaseOwner: sql.NullString{String: fs.owner, Valid: true},
+	})
+	if err != nil {
+		log.Printf("Couldn't release lease on feed %s: %v", id, err)
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	delete(fs.inFlight, id)
+}
+
+// newLeaseOwner identifies this aggregator instance in feed leases.
+func newLeaseOwner() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s/%d/%s", hostname, os.Getpid(), uuid.NewString())
+}
+
+func scrapeFeed(ctx context.Context, db *database.Queries, client *feedClient, feed database.Feed) {
+	_, err := db.MarkFeedFetched(ctx, feed.ID)
+	if err != nil {
+		log.Printf("Couldn't mark feed %s fetched: %v", feed.Name, err)
+		return
+	}
+
+	result, err := fetchFeed(ctx, client, feed.Url, cacheValidators{
+		ETag:         feed.Etag.String,
+		LastModified: feed.LastModified.String,
+	})
+	if err != nil {
+		log.Printf("Couldn't collect feed %s: %v", feed.Name, err)
+		recordFeedFailure(ctx, db, feed, err)
+		return
+	}
+	err = db.RecordFeedSuccess(ctx, database.RecordFeedSuccessParams{
+		NextFetchSeconds: nextFetchDelay(feed, result),
+		ID:               feed.ID,
+	})
+	if err != nil {
+		log.Printf("Couldn't record successful fetch of feed %s: %v", feed.Name, err)
+	}
+	if result.NotModified {
+		log.Printf("Feed %s not modified since last fetch", feed.Name)
+		return
+	}
+
+	feedData := result.Feed
+	if feedData.Link != "" && feedData.Link != feed.SiteUrl.String {
+		err = db.UpdateFeedSiteURL(ctx, database.UpdateFeedSiteURLParams{
+			ID:      feed.ID,
+			SiteUrl: sql.NullString{String: feedData.Link, Valid: true},
+		})
+		if err != nil {
+			log.Printf("Couldn't store site URL of feed %s: %v", feed.Name, err)
+		}
+	}
+	if feedData.ParseWarning != feed.ParseWarning.String {
+		if feedData.ParseWarning != "" {
+			log.Printf("Feed %s is malformed and was parsed leniently: %s", feed.Name, feedData.ParseWarning)
+		}
+		err = db.UpdateFeedParseWarning(ctx, database.UpdateFeedParseWarningParams{
+			ID:           feed.ID,
+			ParseWarning: nullString(feedData.ParseWarning),
+		})
+		if err != nil {
+			log.Printf("Couldn't store parse warning of feed %s: %v", feed.Name, err)
+		}
+	}
+
+	stats := savePosts(ctx, db, feed, feedData.Items)
+
+	// Validators are only stored once the items are in, so an interrupted
+	// scrape is retried in full instead of being answered with 304.
+	err = db.UpdateFeedValidators(ctx, database.UpdateFeedValidatorsParams{
+		ID:           feed.ID,
+		Etag:         nullString(result.Validators.ETag),
+		LastModified: nullString(result.Validators.LastModified),
+	})
+	if err != nil {
+		log.Printf("Couldn't store cache validators for feed %s: %v", feed.Name, err)
+	}
+
+	log.Printf("Feed %s collected, %d posts found: %s", feed.Name, len(feedData.Items), stats)
+}
+
+// postStats counts the outcome of saving the items of a feed.
+type postStats struct {
+	Created   int
+	Estimated int
+	Updated   int
+	Skipped   int
+	Failed    int
+}
+
+func (ps postStats) String() string {
+	return fmt.Sprintf("%d new (%d with estimated dates), %d updated, %d unchanged, %d failed",
+		ps.Created, ps.Estimated, ps.Updated, ps.Skipped, ps.Failed)
+}
+
+// savePosts stores the items of a feed as posts. A post is identified by its
+// GUID within the feed, or by its normalized link when it has none or shares
+// it with other items. Items that are already stored are updated when one of
+// their fields changed and skipped otherwise.
+func savePosts(ctx context.Context, db *database.Queries, feed database.Feed, items []FeedItem) postStats {
+	var stats postStats
+	fetchedAt := time.Now().UTC()
+	repeated := repeatedGUIDs(items)
+	for _, item := range items {
+		link := normalizeURL(item.Link)
+		if link == "" {
+			log.Printf("Skipping post %q from feed %s: missing link", item.Title, feed.Name)
+			stats.Failed++
+			continue
+		}
+		keyGUID := item.GUID
+		if repeated[keyGUID] {
+			keyGUID = ""
+		}
+		dedupKey := postDedupKey(keyGUID, link)
+		if keyGUID != "" {
+			// Posts stored before their feed gave them a GUID are keyed by
+			// their link. They are moved to the GUID instead of being stored
+			// a second time.
+			err := db.AdoptPostGUID(ctx, database.AdoptPostGUIDParams{
+				Guid:   keyGUID,
+				FeedID: feed.ID,
+				Link:   link,
+			})
+			if err != nil {
+				log.Printf("Couldn't move post %q to its GUID: %v", link, err)
+				stats.Failed++
+				continue
+			}
+		}
+
+		// Items without a usable date are stamped with the fetch time and
+		// flagged so they can be told apart from genuinely dated posts.
+		publishedAt, dateErr := parsePubDate(item.PubDate)
+		if dateErr != nil {
+			if strings.TrimSpace(item.PubDate) != "" {
+				log.Printf("Couldn't parse date of post %q from feed %s: %v", link, feed.Name, dateErr)
+			}
+			publishedAt = fetchedAt
+		}
+
+		now := time.Now().UTC()
+		post, err := db.UpsertPost(ctx, database.UpsertPostParams{
+			ID:                   uuid.New(),
+			CreatedAt:            now,
+			UpdatedAt:            now,
+			Title:                item.Title,
+			Url:                  link,
+			Description:          nullString(item.Description),
+			PublishedAt:          sql.NullTime{Time: publishedAt, Valid: true},
+			FeedID:               feed.ID,
+			PublishedAtEstimated: dateErr != nil,
+			Guid:                 nullString(item.GUID),
+			Author:               nullString(item.Author),
+			Content:              nullString(item.Content),
+			CommentsUrl:          nullString(item.CommentsURL),
+			DedupKey:             dedupKey,
+		})
+		unchanged := errors.Is(err, sql.ErrNoRows)
+		if unchanged {
+			post.ID, err = db.GetPostIDByDedupKey(ctx, database.GetPostIDByDedupKeyParams{
+				FeedID:   feed.ID,
+				DedupKey: dedupKey,
+			})
+		}
+		if err != nil {
+			log.Printf("Couldn't save post %q: %v", link, err)
+			stats.Failed++
+			continue
+		}
+		savePostCategories(ctx, db, post.ID, link, item.Categories)
+		savePostEnclosures(ctx, db, post.ID, link, item.Enclosures)
+
+		if unchanged {
+			stats.Skipped++
+			continue
+		}
+		if !post.Inserted {
+			stats.Updated++
+			continue
+		}
+		stats.Created++
+		if dateErr != nil {
+			stats.Estimated++
+		}
+	}
+	return stats
+}
+
+// savePostCategories replaces the stored categories of a post with those of
+// its item, so categories a feed no longer lists are removed.
+func savePostCategories(ctx context.Context, db *database.Queries, postID uuid.UUID, link string, categories []string) {
+	err := db.DeleteStalePostCategories(ctx, database.DeleteStalePostCategoriesParams{
+		PostID: postID,
+		Names:  append([]string{}, categories...),
+	})
+	if err != nil {
+		log.Printf("Couldn't remove old categories of post %q: %v", link, err)
+	}
+	for _, category := range categories {
+		err := db.CreatePostCategory(ctx, database.CreatePostCategoryParams{
+			PostID: postID,
+			Name:   category,
+		})
+		if err != nil {
+			log.Printf("Couldn't store category %q of post %q: %v", category, link, err)
+		}
+	}
+}
+
+// savePostEnclosures replaces the stored enclosures of a post with those of
+// its item. Enclosures that are still listed are updated in place.
+func savePostEnclosures(ctx context.Context, db *database.Queries, postID uuid.UUID, link string, enclosures []FeedEnclosure) {
+	urls := make([]string, 0, len(enclosures))
+	for _, enclosure := range enclosures {
+		urls = append(urls, enclosure.URL)
+	}
+	err := db.DeleteStalePostEnclosures(ctx, database.DeleteStalePostEnclosuresParams{
+		PostID: postID,
+		Urls:   urls,
+	})
+	if err != nil {
+		log.Printf("Couldn't remove old enclosures of post %q: %v", link, err)
+	}
+	for _, enclosure := range enclosures {
+		err := db.CreatePostEnclosure(ctx, database.CreatePostEnclosureParams{
+			PostID:          postID,
+			Url:             enclosure.URL,
+			Kind:            enclosure.Kind,
+			MimeType:        nullString(enclosure.Type),
+			Length:          sql.NullInt64{Int64: enclosure.Length, Valid: enclosure.Length > 0},
+			DurationSeconds: sql.NullInt32{Int32: int32(enclosure.Duration / time.Second), Valid: enclosure.Duration > 0},
+			Episode:         sql.NullInt32{Int32: int32(enclosure.Episode), Valid: enclosure.Episode > 0},
+		})
+		if err != nil {
+			log.Printf("Couldn't store enclosure %q of post %q: %v", enclosure.URL, link, err)
+		}
+	}
+}
+
+// repeatedGUIDs returns the GUIDs used by more than one item of a feed. Like
+// migration 014 does for stored posts, such items are identified by their
+// link, as keying them by the GUID would store them all as one post.
+func repeatedGUIDs(items []FeedItem) map[string]bool {
+	counts := make(map[string]int)
+	for _, item := range items {
+		if item.GUID != "" {
+			counts[item.GUID]++
+		}
+	}
+	repeated := make(map[string]bool)
+	for guid, count := range counts {
+		if count > 1 {
+			repeated[guid] = true
+		}
+	}
+	return repeated
+}
+
+// postDedupKey is the identity of a post within its feed: its GUID, or its
+// normalized link when it has none.
+func postDedupKey(guid, link string) string {
+	if guid != "" {
+		return guid
+	}
+	return link
+}
+
+// normalizeURL trims a post link and strips its fragment and utm_* tracking
+// parameters, so the same article shared with different tracking parameters
+// is stored once. The remaining parameters are kept as they are, in their
+// order, so that migration 014 can normalize stored links the same way in SQL.
+func normalizeURL(rawURL string) string {
+	link, _, _ := strings.Cut(strings.TrimSpace(rawURL), "#")
+	base, query, found := strings.Cut(link, "?")
+	if !found || query == "" {
+		return link
+	}
+	var kept []string
+	for _, param := range strings.Split(query, "&") {
+		name, _, _ := strings.Cut(param, "=")
+		if strings.HasPrefix(strings.ToLower(name), "utm_") {
+			continue
+		}
+		kept = append(kept, param)
+	}
+	if len(kept) == 0 {
+		return base
+	}
+	return base + "?" + strings.Join(kept, "&")
+}
+
+// recordFeedFailure stores the error of a failed fetch and schedules the next
+// attempt with exponential backoff.
+func recordFeedFailure(ctx context.Context, db *database.Queries, feed database.Feed, fetchErr error) {
+	// The fetch may have failed because ctx timed out, which must not stop
+	// the failure from being recorded.
+	ctx = context.WithoutCancel(ctx)
+
+	backoff := failureBackoff(feed.ConsecutiveFailures + 1)
+	var statusErr *statusError
+	if errors.As(fetchErr, &statusErr) {
+		backoff = max(backoff, statusErr.RetryAfter)
+	}
+	err := db.RecordFeedFailure(ctx, database.RecordFeedFailureParams{
+		LastError:    sql.NullString{String: fetchErr.Error(), Valid: true},
+		RetrySeconds: durationSeconds(backoff),
+		ID:           feed.ID,
+	})
+	if err != nil {
+		log.Printf("Couldn't record failed fetch of feed %s: %v", feed.Name, err)
+		return
+	}
+	log.Printf("Feed %s has failed %d times in a row, retrying in %s", feed.Name, feed.ConsecutiveFailures+1, backoff)
+}
+
+// nextFetchDelay decides when a successfully fetched feed is due again: after
+// the feed's own fetch interval, or later if the feed's TTL or the server's
+// Cache-Control header ask for it. A null delay means the feed is due on the
+// next tick.
+func nextFetchDelay(feed database.Feed, result *fetchResult) sql.NullInt32 {
+	hint := result.MaxAge
+	if result.Feed != nil {
+		hint = max(hint, result.Feed.TTL)
+	}
+	interval := min(hint, maxHintInterval)
+	if feed.FetchIntervalSeconds.Valid {
+		interval = max(interval, time.Duration(feed.FetchIntervalSeconds.Int32)*time.Second)
+	}
+
+	if interval < time.Second {
+		return sql.NullInt32{}
+	}
+	return sql.NullInt32{Int32: durationSeconds(interval), Valid: true}
+}
+
+// failureBackoff returns how long to wait before retrying a feed that has
+// failed the given number of times in a row. The delay doubles from
+// failureBackoffBase with each failure, up to failureBackoffMax.
+func failureBackoff(failures int32) time.Duration {
+	backoff := failureBackoffBase
+	for i := int32(1); i < failures && backoff < failureBackoffMax; i++ {
+		backoff *= 2
+	}
+	return min(backoff, failureBackoffMax)
+}
+
+// durationSeconds converts a delay to the whole seconds the scheduling queries
+// take, capped at what fits in an int.
+func durationSeconds(d time.Duration) int32 {
+	return int32(min(d, math.MaxInt32*time.Second) / time.Second)
+}
+
+// nullString maps empty strings to NULL.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// isUniqueViolation reports whether err is a Postgres unique constraint
+// violation.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// isForeignKeyViolation reports whether err is a Postgres foreign key
+// violation, i.e. a referenced row doesn't exist.
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"database/sql"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/KrishKoria/Gator/internal/database"
+)
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"plain", "https://example.com/post", "https://example.com/post"},
+		{"surrounding whitespace", "  https://example.com/post\n", "https://example.com/post"},
+		{"fragment", "https://example.com/post#comments", "https://example.com/post"},
+		{"utm parameters only", "https://example.com/post?utm_source=rss&utm_medium=feed", "https://example.com/post"},
+		{"utm parameters mixed", "https://example.com/post?id=7&utm_source=rss&page=2", "https://example.com/post?id=7&page=2"},
+		{"uppercase utm", "https://example.com/post?UTM_Campaign=x&id=7", "https://example.com/post?id=7"},
+		{"parameter order kept", "https://example.com/post?b=2&a=1", "https://example.com/post?b=2&a=1"},
+		{"escaping kept", "https://example.com/post?q=a%20b&utm_term=x", "https://example.com/post?q=a%20b"},
+		{"empty parameters kept", "https://example.com/post?a=1&&b=2", "https://example.com/post?a=1&&b=2"},
+		{"empty query", "https://example.com/post?", "https://example.com/post?"},
+		{"utm lookalike", "https://example.com/post?utmost=1", "https://example.com/post?utmost=1"},
+		{"fragment with query", "https://example.com/post?utm_source=rss#top", "https://example.com/post"},
+		{"question mark in query", "https://example.com/post?next=/a?b&utm_source=x", "https://example.com/post?next=/a?b"},
+		{"empty", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeURL(tt.input); got != tt.want {
+				t.Errorf("normalizeURL(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+			if got := normalizeURL(tt.want); got != tt.want {
+				t.Errorf("normalizeURL(%q) = %q, want it unchanged", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPostDedupKey(t *testing.T) {
+	tests := []struct {
+		name string
+		guid string
+		link string
+		want string
+	}{
+		{"guid", "tag:example.com,2024:1", "https://example.com/post", "tag:example.com,2024:1"},
+		{"no guid", "", "https://example.com/post", "https://example.com/post"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := postDedupKey(tt.guid, tt.link); got != tt.want {
+				t.Errorf("postDedupKey(%q, %q) = %q, want %q", tt.guid, tt.link, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepeatedGUIDs(t *testing.T) {
+	tests := []struct {
+		name  string
+		guids []string
+		want  map[string]bool
+	}{
+		{"unique", []string{"a", "b", "c"}, map[string]bool{}},
+		{"repeated", []string{"a", "b", "a", "c", "a"}, map[string]bool{"a": true}},
+		{"several repeated", []string{"a", "b", "b", "a"}, map[string]bool{"a": true, "b": true}},
+		{"missing guids", []string{"", "", "a"}, map[string]bool{}},
+		{"no items", nil, map[string]bool{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items := make([]FeedItem, 0, len(tt.guids))
+			for _, guid := range tt.guids {
+				items = append(items, FeedItem{GUID: guid})
+			}
+			if got := repeatedGUIDs(items); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("repeatedGUIDs(%q) = %v, want %v", tt.guids, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFailureBackoff(t *testing.T) {
+	tests := []struct {
+		failures int32
+		want     time.Duration
+	}{
+		{0, time.Minute},
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{6, 32 * time.Minute},
+		{11, 1024 * time.Minute},
+		{12, 24 * time.Hour},
+		{1000, 24 * time.Hour},
+		{math.MaxInt32, 24 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := failureBackoff(tt.failures); got != tt.want {
+			t.Errorf("failureBackoff(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestDurationSeconds(t *testing.T) {
+	tests := []struct {
+		input time.Duration
+		want  int32
+	}{
+		{0, 0},
+		{1500 * time.Millisecond, 1},
+		{24 * time.Hour, 86400},
+		{math.MaxInt32 * time.Second, math.MaxInt32},
+		{math.MaxInt64, math.MaxInt32},
+	}
+
+	for _, tt := range tests {
+		if got := durationSeconds(tt.input); got != tt.want {
+			t.Errorf("durationSeconds(%v) = %d, want %d", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestNextFetchDelay(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval sql.NullInt32
+		result   fetchResult
+		want     sql.NullInt32
+	}{
+		{"no hints", sql.NullInt32{}, fetchResult{Feed: &ParsedFeed{}}, sql.NullInt32{}},
+		{"not modified", sql.NullInt32{}, fetchResult{NotModified: true}, sql.NullInt32{}},
+		{"ttl", sql.NullInt32{}, fetchResult{Feed: &ParsedFeed{TTL: time.Hour}}, sql.NullInt32{Int32: 3600, Valid: true}},
+		{"max age beats ttl", sql.NullInt32{}, fetchResult{Feed: &ParsedFeed{TTL: time.Minute}, MaxAge: 10 * time.Minute}, sql.NullInt32{Int32: 600, Valid: true}},
+		{"hint capped", sql.NullInt32{}, fetchResult{Feed: &ParsedFeed{TTL: 7 * 24 * time.Hour}}, sql.NullInt32{Int32: 86400, Valid: true}},
+		{"interval beats hint", sql.NullInt32{Int32: 7200, Valid: true}, fetchResult{MaxAge: time.Minute}, sql.NullInt32{Int32: 7200, Valid: true}},
+		{"interval not capped", sql.NullInt32{Int32: 7 * 86400, Valid: true}, fetchResult{}, sql.NullInt32{Int32: 7 * 86400, Valid: true}},
+		{"sub-second hint", sql.NullInt32{}, fetchResult{MaxAge: time.Millisecond}, sql.NullInt32{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			feed := database.Feed{FetchIntervalSeconds: tt.interval}
+			if got := nextFetchDelay(feed, &tt.result); got != tt.want {
+				t.Errorf("nextFetchDelay() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,17 +1,18 @@
 -- name: CreateFeed :one
-INSERT INTO feeds (id, created_at, updated_at, name, url, user_id)
+INSERT INTO feeds (id, created_at, updated_at, name, url, user_id, fetch_interval_seconds)
 VALUES (
     $1,
     $2,
     $3,
     $4,
     $5,
-    $6
+    $6,
+    $7
 )
 RETURNING *;
 
 -- name: GetFeedsWithUsers :many
-SELECT feeds.name AS feed_name, feeds.url, users.name AS user_name
+SELECT feeds.id, feeds.created_at, feeds.name AS feed_name, feeds.url, feeds.site_url, feeds.fetch_interval_seconds, feeds.last_fetched_at, users.name AS user_name
 FROM feeds
 JOIN users ON feeds.user_id = users.id;
 
@@ -24,8 +25,8 @@ LIMIT 1;
 
 -- name: CreateFeedFollow :one
 WITH inserted_follow AS (
-  INSERT INTO feed_follows (id, created_at, updated_at, user_id, feed_id)
-  VALUES ($1, $2, $3, $4, $5)
+  INSERT INTO feed_follows (id, created_at, updated_at, user_id, feed_id, folder)
+  VALUES ($1, $2, $3, $4, $5, $6)
   RETURNING *
 )
 SELECT 
@@ -40,7 +41,9 @@ JOIN feeds ON inserted_follow.feed_id = feeds.id;
 SELECT 
   feed_follows.*,
   users.name AS user_name,
-  feeds.name AS feed_name
+  feeds.name AS feed_name,
+  feeds.url AS feed_url,
+  feeds.site_url
 FROM feed_follows
 JOIN users ON feed_follows.user_id = users.id
 JOIN feeds ON feed_follows.feed_id = feeds.id
@@ -62,10 +65,81 @@ updated_at = NOW()
 WHERE id = $1
 RETURNING *;
 
--- name: GetNextFeedToFetch :one
-SELECT * FROM feeds
-ORDER BY last_fetched_at ASC NULLS FIRST
-LIMIT 1;
+-- name: ClaimFeedsToFetch :many
+-- Leases the stalest unleased feeds that are due to one aggregator instance.
+-- SKIP LOCKED lets concurrent instances claim disjoint batches, and an expired
+-- lease (from a crashed instance) makes the feed claimable again.
+UPDATE feeds
+SET lease_owner = sqlc.arg(lease_owner)::text,
+lease_expires_at = NOW() + (sqlc.arg(lease_seconds)::int * INTERVAL '1 second')
+WHERE id IN (
+  SELECT id FROM feeds
+  WHERE (lease_expires_at IS NULL OR lease_expires_at < NOW())
+  AND (next_fetch_at IS NULL OR next_fetch_at <= NOW())
+  ORDER BY last_fetched_at ASC NULLS FIRST
+  LIMIT sqlc.arg(batch_size)
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: UpdateFeedValidators :exec
+UPDATE feeds
+SET etag = $2,
+last_modified = $3,
+updated_at = NOW()
+WHERE id = $1;
+
+-- name: ReleaseFeedLease :exec
+UPDATE feeds
+SET lease_owner = NULL,
+lease_expires_at = NULL
+WHERE id = $1
+AND lease_owner = $2;
 
 -- name: DeleteAllFeeds :exec
-DELETE FROM feeds;
\ No newline at end of file
+DELETE FROM feeds;
+
+-- name: RecordFeedSuccess :exec
+-- A null next_fetch_seconds makes the feed due on the next tick.
+UPDATE feeds
+SET consecutive_failures = 0,
+last_error = NULL,
+last_success_at = NOW(),
+next_fetch_at = NOW() + (sqlc.narg(next_fetch_seconds)::int * INTERVAL '1 second'),
+updated_at = NOW()
+WHERE id = sqlc.arg(id);
+
+-- name: RecordFeedFailure :exec
+-- The next attempt is scheduled with NOW(), like the comparison in
+-- ClaimFeedsToFetch, so the time zone of the aggregator doesn't matter.
+UPDATE feeds
+SET consecutive_failures = consecutive_failures + 1,
+last_error = sqlc.arg(last_error),
+next_fetch_at = NOW() + (sqlc.arg(retry_seconds)::int * INTERVAL '1 second'),
+updated_at = NOW()
+WHERE id = sqlc.arg(id);
+
+-- name: GetUnhealthyFeeds :many
+-- Feeds whose last fetches failed, or that could only be parsed in lenient
+-- mode.
+SELECT * FROM feeds
+WHERE consecutive_failures > 0 OR parse_warning IS NOT NULL
+ORDER BY consecutive_failures DESC, name ASC;
+
+-- name: UpdateFeedFetchInterval :exec
+UPDATE feeds
+SET fetch_interval_seconds = $2,
+updated_at = NOW()
+WHERE id = $1;
+
+-- name: UpdateFeedParseWarning :exec
+UPDATE feeds
+SET parse_warning = $2,
+updated_at = NOW()
+WHERE id = $1;
+
+-- name: UpdateFeedSiteURL :exec
+UPDATE feeds
+SET site_url = $2,
+updated_at = NOW()
+WHERE id = $1;
@@ -1,7 +1,187 @@
--- name: CreatePost :one
-INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id)
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-RETURNING *;
+-- name: UpsertPost :one
+-- Inserts a post, or updates the stored post with the same identity in its
+-- feed when its title, URL, description, content, author or comments link
+-- changed. No row is returned when the post is already stored unchanged.
+INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id, published_at_estimated, guid, author, content, comments_url, dedup_key)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+ON CONFLICT (feed_id, dedup_key) DO UPDATE
+SET title = EXCLUDED.title,
+url = EXCLUDED.url,
+description = EXCLUDED.description,
+author = EXCLUDED.author,
+content = EXCLUDED.content,
+comments_url = EXCLUDED.comments_url,
+updated_at = EXCLUDED.updated_at
+WHERE posts.title IS DISTINCT FROM EXCLUDED.title
+OR posts.description IS DISTINCT FROM EXCLUDED.description
+OR posts.content IS DISTINCT FROM EXCLUDED.content
+OR posts.url IS DISTINCT FROM EXCLUDED.url
+OR posts.author IS DISTINCT FROM EXCLUDED.author
+OR posts.comments_url IS DISTINCT FROM EXCLUDED.comments_url
+RETURNING id, (xmax = 0)::boolean AS inserted;
 
 -- name: DeleteAllPosts :exec
-DELETE FROM posts;
\ No newline at end of file
+DELETE FROM posts;
+
+-- name: AdoptPostGUID :exec
+-- Moves a post stored under its normalized link, before its feed gave it a
+-- GUID or while the GUID was shared with other items, to the GUID. Nothing
+-- changes when a post is already stored under the GUID.
+UPDATE posts
+SET guid = sqlc.arg(guid)::text,
+dedup_key = sqlc.arg(guid)::text
+WHERE feed_id = sqlc.arg(feed_id)
+AND dedup_key = sqlc.arg(link)::text
+AND (guid IS NULL OR guid = sqlc.arg(guid)::text)
+AND NOT EXISTS (
+  SELECT 1 FROM posts other
+  WHERE other.feed_id = sqlc.arg(feed_id) AND other.dedup_key = sqlc.arg(guid)::text
+);
+
+-- name: GetPostIDByDedupKey :one
+SELECT id FROM posts
+WHERE feed_id = $1 AND dedup_key = $2;
+
+-- name: CreatePostCategory :exec
+INSERT INTO post_categories (post_id, name)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteStalePostCategories :exec
+-- Removes the categories of a post that are not in names.
+DELETE FROM post_categories
+WHERE post_id = sqlc.arg(post_id) AND NOT (name = ANY(sqlc.arg(names)::text[]));
+
+-- name: CreatePostEnclosure :exec
+INSERT INTO post_enclosures (post_id, url, kind, mime_type, length, duration_seconds, episode)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (post_id, url) DO UPDATE
+SET kind = EXCLUDED.kind,
+mime_type = EXCLUDED.mime_type,
+length = EXCLUDED.length,
+duration_seconds = EXCLUDED.duration_seconds,
+episode = EXCLUDED.episode;
+
+-- name: DeleteStalePostEnclosures :exec
+-- Removes the enclosures of a post whose URL is not in urls.
+DELETE FROM post_enclosures
+WHERE post_id = sqlc.arg(post_id) AND NOT (url = ANY(sqlc.arg(urls)::text[]));
+
+-- name: GetPostEnclosures :many
+SELECT * FROM post_enclosures
+WHERE post_id = $1
+ORDER BY kind, url;
+
+-- name: MarkPostRead :exec
+INSERT INTO post_reads (user_id, post_id, read_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, post_id) DO NOTHING;
+
+-- name: MarkPostUnread :execrows
+DELETE FROM post_reads
+WHERE user_id = $1 AND post_id = $2;
+
+-- name: MarkPostsRead :execrows
+-- Marks the posts of the feeds a user follows as read, optionally only those
+-- of one feed or published before a given time.
+INSERT INTO post_reads (user_id, post_id, read_at)
+SELECT feed_follows.user_id, posts.id, sqlc.arg(read_at)
+FROM posts
+JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+JOIN feeds ON posts.feed_id = feeds.id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+AND (sqlc.narg(feed_url)::text IS NULL OR feeds.url = sqlc.narg(feed_url))
+AND (sqlc.narg(before)::timestamp IS NULL OR posts.published_at < sqlc.narg(before))
+ON CONFLICT (user_id, post_id) DO NOTHING;
+
+-- name: StarPost :execrows
+-- Saves a snapshot of a post for a user. Starring a post again refreshes the
+-- snapshot. No row is affected when the post doesn't exist.
+INSERT INTO saved_posts (user_id, post_id, saved_at, feed_name, title, url, description, content, author, published_at)
+SELECT $1, posts.id, $3, feeds.name, posts.title, posts.url, posts.description, posts.content, posts.author, posts.published_at
+FROM posts
+JOIN feeds ON posts.feed_id = feeds.id
+WHERE posts.id = $2
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET feed_name = EXCLUDED.feed_name,
+title = EXCLUDED.title,
+url = EXCLUDED.url,
+description = EXCLUDED.description,
+content = EXCLUDED.content,
+author = EXCLUDED.author,
+published_at = EXCLUDED.published_at;
+
+-- name: UnstarPost :execrows
+DELETE FROM saved_posts
+WHERE user_id = $1 AND post_id = $2;
+
+-- name: GetStarredPosts :many
+SELECT * FROM saved_posts
+WHERE user_id = $1
+ORDER BY saved_at DESC;
+
+-- name: IsPostFollowed :one
+-- Reports whether a post belongs to a feed the user follows.
+SELECT EXISTS (
+  SELECT 1 FROM posts
+  JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+  WHERE posts.id = $1 AND feed_follows.user_id = $2
+);
+
+-- name: BrowsePosts :many
+-- Lists the posts of the feeds a user follows. Every filter is optional. Pages
+-- are either skipped with offset or continue after the post given as after,
+-- in the order selected by sort: newest, oldest or feed. Posts without a
+-- publication date are ordered by the time they were stored.
+WITH cursor AS (
+  SELECT coalesce(posts.published_at, posts.created_at) AS sort_at, posts.id, feeds.name AS feed_name
+  FROM posts
+  JOIN feeds ON posts.feed_id = feeds.id
+  WHERE posts.id = sqlc.narg(after)
+)
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.published_at_estimated, posts.guid, posts.author, posts.content, posts.comments_url, posts.dedup_key, feeds.name AS feed_name, post_reads.read_at
+FROM posts
+JOIN feeds ON posts.feed_id = feeds.id
+JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+LEFT JOIN post_reads ON post_reads.post_id = posts.id AND post_reads.user_id = feed_follows.user_id
+LEFT JOIN cursor ON TRUE
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+AND (sqlc.arg(include_read)::boolean OR post_reads.post_id IS NULL)
+AND (sqlc.narg(feed)::text IS NULL OR feeds.url = sqlc.narg(feed) OR feeds.name = sqlc.narg(feed))
+AND (sqlc.narg(since)::timestamp IS NULL OR posts.published_at >= sqlc.narg(since))
+AND (sqlc.narg(until)::timestamp IS NULL OR posts.published_at < sqlc.narg(until))
+AND (sqlc.narg(search)::text IS NULL
+  OR strpos(lower(posts.title), lower(sqlc.narg(search))) > 0
+  OR strpos(lower(posts.description), lower(sqlc.narg(search))) > 0
+  OR strpos(lower(posts.content), lower(sqlc.narg(search))) > 0)
+AND (sqlc.narg(after)::uuid IS NULL OR CASE sqlc.arg(sort)::text
+  WHEN 'oldest' THEN (coalesce(posts.published_at, posts.created_at), posts.id) > (cursor.sort_at, cursor.id)
+  WHEN 'feed' THEN feeds.name > cursor.feed_name
+    OR (feeds.name = cursor.feed_name AND (coalesce(posts.published_at, posts.created_at), posts.id) < (cursor.sort_at, cursor.id))
+  ELSE (coalesce(posts.published_at, posts.created_at), posts.id) < (cursor.sort_at, cursor.id)
+END)
+ORDER BY
+  CASE WHEN sqlc.arg(sort)::text = 'feed' THEN feeds.name END,
+  CASE WHEN sqlc.arg(sort)::text = 'oldest' THEN coalesce(posts.published_at, posts.created_at) END,
+  CASE WHEN sqlc.arg(sort)::text = 'oldest' THEN posts.id END,
+  coalesce(posts.published_at, posts.created_at) DESC,
+  posts.id DESC
+LIMIT sqlc.arg('limit')
+OFFSET sqlc.arg('offset');
+
+-- name: SearchPosts :many
+-- Full-text search over the posts of the feeds a user follows, or of every
+-- feed when all_feeds is set. The query uses web search syntax: quoted
+-- phrases, OR and -excluded words.
+SELECT posts.id, posts.title, posts.url, posts.published_at, feeds.name AS feed_name,
+  ts_rank(posts.search_vector, websearch_to_tsquery('english', sqlc.arg(query))) AS rank,
+  ts_headline('english', concat_ws(' ', posts.title, posts.description, posts.content), websearch_to_tsquery('english', sqlc.arg(query)), 'StartSel=**, StopSel=**, MaxFragments=2')::text AS headline
+FROM posts
+JOIN feeds ON posts.feed_id = feeds.id
+WHERE posts.search_vector @@ websearch_to_tsquery('english', sqlc.arg(query))
+AND (sqlc.arg(all_feeds)::boolean OR EXISTS (
+  SELECT 1 FROM feed_follows
+  WHERE feed_follows.feed_id = posts.feed_id AND feed_follows.user_id = sqlc.arg(user_id)
+))
+ORDER BY rank DESC, posts.published_at DESC
+LIMIT sqlc.arg('limit');
@@ -16,12 +16,3 @@ DELETE FROM users;
 
 -- name: GetUsers :many
 SELECT * FROM users;
-
--- name: GetPostsForUser :many
-SELECT posts.*
-FROM posts
-JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
-JOIN users ON feed_follows.user_id = users.id
-WHERE users.name = $1
-ORDER BY posts.published_at DESC
-LIMIT $2;
\ No newline at end of file
@@ -0,0 +1,27 @@
+-- +goose Up
+ALTER TABLE posts
+ADD COLUMN guid TEXT NULL,
+ADD COLUMN author TEXT NULL,
+ADD COLUMN content TEXT NULL,
+ADD COLUMN comments_url TEXT NULL;
+
+CREATE INDEX posts_feed_id_guid_idx ON posts(feed_id, guid);
+
+CREATE TABLE post_categories (
+  post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  PRIMARY KEY (post_id, name)
+);
+
+CREATE INDEX post_categories_name_idx ON post_categories(name);
+
+-- +goose Down
+DROP TABLE post_categories;
+
+DROP INDEX posts_feed_id_guid_idx;
+
+ALTER TABLE posts
+DROP COLUMN guid,
+DROP COLUMN author,
+DROP COLUMN content,
+DROP COLUMN comments_url;
@@ -0,0 +1,65 @@
+-- +goose Up
+ALTER TABLE posts
+ADD COLUMN dedup_key TEXT NULL;
+
+-- Posts are identified by their GUID within a feed, falling back to the
+-- normalized URL for items without one or whose GUID isn't unique. The URL is
+-- normalized like normalizeURL does: trimmed, without its fragment and without
+-- utm_* query parameters. When several posts of a feed normalize to the same
+-- URL, the one already stored under it keeps it and the others keep their raw
+-- URL.
+WITH links AS (
+  SELECT id, feed_id, url, created_at, split_part(btrim(url, E' \t\n\r\f\v'), '#', 1) AS link
+  FROM posts
+), parts AS (
+  SELECT id, feed_id, url, created_at,
+    CASE WHEN strpos(link, '?') > 0 THEN left(link, strpos(link, '?') - 1) ELSE link END AS base,
+    CASE WHEN strpos(link, '?') > 0 THEN substr(link, strpos(link, '?') + 1) END AS query
+  FROM links
+), normalized AS (
+  SELECT id, feed_id, url, created_at,
+    CASE
+      WHEN query IS NULL THEN base
+      WHEN query = '' THEN base || '?'
+      ELSE base || coalesce('?' || (
+        SELECT string_agg(param, '&' ORDER BY position)
+        FROM unnest(string_to_array(query, '&')) WITH ORDINALITY AS params(param, position)
+        WHERE lower(split_part(param, '=', 1)) NOT LIKE 'utm\_%'
+      ), '')
+    END AS key
+  FROM parts
+), ranked AS (
+  SELECT id, url, key,
+    row_number() OVER (PARTITION BY feed_id, key ORDER BY url = key DESC, created_at, id) AS rank
+  FROM normalized
+)
+UPDATE posts SET dedup_key = CASE WHEN ranked.rank = 1 THEN ranked.key ELSE ranked.url END
+FROM ranked
+WHERE posts.id = ranked.id;
+
+UPDATE posts SET dedup_key = guid
+WHERE guid IS NOT NULL
+AND (feed_id, guid) IN (
+  SELECT feed_id, guid FROM posts
+  WHERE guid IS NOT NULL
+  GROUP BY feed_id, guid
+  HAVING COUNT(*) = 1
+)
+AND NOT EXISTS (
+  SELECT 1 FROM posts other
+  WHERE other.feed_id = posts.feed_id
+  AND other.id <> posts.id
+  AND other.dedup_key = posts.guid
+);
+
+ALTER TABLE posts
+ALTER COLUMN dedup_key SET NOT NULL,
+DROP CONSTRAINT posts_url_key,
+ADD CONSTRAINT posts_feed_id_dedup_key_key UNIQUE (feed_id, dedup_key);
+
+-- +goose Down
+-- The URL is not made unique again: posts of different feeds may share it by
+-- now.
+ALTER TABLE posts
+DROP CONSTRAINT posts_feed_id_dedup_key_key,
+DROP COLUMN dedup_key;
@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE post_enclosures (
+  post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+  url TEXT NOT NULL,
+  kind TEXT NOT NULL,
+  mime_type TEXT NULL,
+  length BIGINT NULL,
+  duration_seconds INT NULL,
+  episode INT NULL,
+  PRIMARY KEY (post_id, url)
+);
+
+-- +goose Down
+DROP TABLE post_enclosures;
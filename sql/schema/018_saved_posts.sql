@@ -0,0 +1,19 @@
+-- +goose Up
+-- Saved posts keep a snapshot of the post instead of referencing it, so they
+-- survive the post being deleted or its feed being unfollowed or removed.
+CREATE TABLE saved_posts (
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  post_id UUID NOT NULL,
+  saved_at TIMESTAMP NOT NULL,
+  feed_name TEXT NOT NULL,
+  title TEXT NOT NULL,
+  url TEXT NOT NULL,
+  description TEXT NULL,
+  content TEXT NULL,
+  author TEXT NULL,
+  published_at TIMESTAMP NULL,
+  PRIMARY KEY (user_id, post_id)
+);
+
+-- +goose Down
+DROP TABLE saved_posts;